@@ -0,0 +1,113 @@
+// Command map-tracker-replay evaluates MapTrackerInfer offline against recorded screenshots.
+//
+// Usage:
+//
+//	map-tracker-replay -resource ../../assets/resource -frames ./frames -truth ./truth.json [-precision 0.4,0.8] [-track] [-out report.json]
+//
+// To benchmark the inference, use -repeat to run each frame several times and -workers to set the matching worker pool size.
+//
+// The ground truth file maps each frame file name to {"mapName", "x", "y", "rot"}.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	maptracker "github.com/MaaXYZ/MaaEnd/agent/go-service/map-tracker"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	resourceDir := flag.String("resource", "resource", "resource root directory containing image/MapTracker")
+	framesDir := flag.String("frames", "", "directory of recorded 1280x720 frames")
+	truthPath := flag.String("truth", "", "ground truth JSON file")
+	precisions := flag.String("precision", "0.2,0.4,0.6,0.8,1.0", "comma separated precision levels to evaluate")
+	regex := flag.String("regex", "", "map name regex (defaults to the MapTrackerInfer default)")
+	threshold := flag.Float64("threshold", 0.0, "confidence threshold (defaults to the MapTrackerInfer default)")
+	track := flag.Bool("track", false, "replay frames in file name order as a sequence in tracking mode")
+	noRelocalize := flag.Bool("no-relocalize", false, "disable feature relocalization in tracking mode")
+	noMask := flag.Bool("no-mask", false, "disable the mini-map mask")
+	geometry := flag.String("geometry", "", "geometry profile name (defaults to the profile selected for Win32)")
+	outPath := flag.String("out", "", "optional path to write the full JSON report")
+	workers := flag.Int("workers", 0, "template matching worker pool size (defaults to GOMAXPROCS minus one)")
+	repeat := flag.Int("repeat", 1, "number of times to run the inference of each frame, for benchmarking")
+	backend := flag.String("backend", "", "template matching backend: auto, direct or fft (defaults to auto)")
+	checkBackends := flag.Bool("check-backends", false, "compare the scores of the FFT and the direct matching backends")
+	verbose := flag.Bool("v", false, "enable debug logging")
+	flag.Parse()
+
+	level := zerolog.InfoLevel
+	if *verbose {
+		level = zerolog.DebugLevel
+	}
+	log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).
+		Level(level).With().Timestamp().Logger()
+
+	if *framesDir == "" || *truthPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var levels []float64
+	for _, s := range strings.Split(*precisions, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			log.Fatal().Err(err).Str("precision", s).Msg("Invalid precision value")
+		}
+		levels = append(levels, v)
+	}
+
+	report, err := maptracker.RunReplay(maptracker.ReplayOptions{
+		ResourceDir:   *resourceDir,
+		FramesDir:     *framesDir,
+		TruthPath:     *truthPath,
+		Precisions:    levels,
+		MapNameRegex:  *regex,
+		Threshold:     *threshold,
+		Track:         *track,
+		NoRelocalize:  *noRelocalize,
+		NoMask:        *noMask,
+		Geometry:      *geometry,
+		Workers:       *workers,
+		Repeat:        *repeat,
+		Backend:       *backend,
+		CheckBackends: *checkBackends,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Replay failed")
+	}
+
+	if res := report.Resources; res != nil {
+		fmt.Printf("resources: %d maps, %d errors, %d warnings\n", len(res.Maps), res.Errors(), len(res.Issues)-res.Errors())
+	}
+	fmt.Printf("%-9s %6s %6s %7s %9s %9s %9s %9s %9s %9s %9s %9s\n",
+		"precision", "frames", "hits", "mapAcc", "locErr50", "locErr90", "rotErr50", "locConf50", "locMs", "rotMs", "inferMs", "inferP90")
+	for _, l := range report.Levels {
+		fmt.Printf("%-9.2f %6d %6d %7.3f %9.2f %9.2f %9.1f %9.3f %9.1f %9.1f %9.2f %9.2f\n",
+			l.Precision, l.Frames, l.Hits, l.MapAccuracy,
+			l.LocError.P50, l.LocError.P90, l.RotError.P50, l.LocConf.P50,
+			l.LocTimeMs.Mean, l.RotTimeMs.Mean, l.InferMs.Mean, l.InferMs.P90)
+	}
+	if *checkBackends {
+		for _, l := range report.Levels {
+			fmt.Printf("precision %.2f: max score difference between matching backends %.3g\n", l.Precision, l.BackendDiff.Max)
+		}
+	}
+
+	if *outPath != "" {
+		data, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to marshal report")
+		}
+		if err := os.WriteFile(*outPath, data, 0644); err != nil {
+			log.Fatal().Err(err).Str("path", *outPath).Msg("Failed to write report")
+		}
+		log.Info().Str("path", *outPath).Msg("Report written")
+	}
+}
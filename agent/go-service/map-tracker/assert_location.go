@@ -4,8 +4,6 @@ package maptracker
 import (
 	"encoding/json"
 	"fmt"
-	"regexp"
-	"strings"
 
 	"github.com/MaaXYZ/maa-framework-go/v4"
 	"github.com/rs/zerolog/log"
@@ -27,6 +25,8 @@ type MapTrackerAssertLocationParam struct {
 	Precision float64 `json:"precision,omitempty"`
 	// Threshold controls the minimum confidence required to consider the inference successful.
 	Threshold float64 `json:"threshold,omitempty"`
+	// MinMargin is the minimum confidence margin between the best and the second best candidates.
+	MinMargin float64 `json:"min_margin,omitempty"`
 	// Whether to enable fast mode for matching.
 	FastMode bool `json:"fast_mode,omitempty"`
 }
@@ -45,20 +45,11 @@ func (r *MapTrackerAssertLocation) Run(ctx *maa.Context, arg *maa.CustomRecognit
 	mapNameRegex := ".*"
 	if param.FastMode {
 		// Build map_name_regex based on expected conditions to focus the search
-		mapNamesMap := make(map[string]struct{})
-		var mapNames []string
+		mapNames := make([]string, 0, len(param.Expected))
 		for _, condition := range param.Expected {
-			if _, exists := mapNamesMap[condition.MapName]; !exists {
-				mapNamesMap[condition.MapName] = struct{}{}
-				mapNames = append(mapNames, regexp.QuoteMeta(condition.MapName))
-			}
-		}
-		if len(mapNames) == 0 {
-			log.Error().Msg("Failed to extract map names from expected conditions")
-			return nil, false
+			mapNames = append(mapNames, condition.MapName)
 		}
-
-		mapNameRegex = "^(" + strings.Join(mapNames, "|") + ")$"
+		mapNameRegex = calcMapNamesRegex(mapNames)
 	}
 
 	// Prepare and run MapTrackerInfer
@@ -71,6 +62,7 @@ func (r *MapTrackerAssertLocation) Run(ctx *maa.Context, arg *maa.CustomRecognit
 				"map_name_regex": mapNameRegex,
 				"precision":      param.Precision,
 				"threshold":      param.Threshold,
+				"min_margin":     param.MinMargin,
 			},
 		},
 	}
@@ -87,26 +79,23 @@ func (r *MapTrackerAssertLocation) Run(ctx *maa.Context, arg *maa.CustomRecognit
 	}
 
 	// Extract inference result
-	var result MapTrackerInferResult
-	var wrapped struct {
-		Best struct {
-			Detail json.RawMessage `json:"detail"`
-		} `json:"best"`
-	}
-	if err := json.Unmarshal([]byte(res.DetailJson), &wrapped); err != nil {
-		log.Error().Err(err).Msg("Failed to unmarshal wrapped inference result")
+	result, err := parseInferDetail(res.DetailJson)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse inference result")
 		return nil, false
 	}
-	if err := json.Unmarshal(wrapped.Best.Detail, &result); err != nil {
-		log.Error().Err(err).Msg("Failed to unmarshal MapTrackerInferResult")
+	if result.Margin < param.MinMargin {
+		log.Info().Float64("margin", result.Margin).Msg("Location assertion not satisfied, inference result is ambiguous")
 		return nil, false
 	}
 
 	// Check if current location satisfies any of the expected conditions
 	for _, condition := range param.Expected {
-		if result.MapName == condition.MapName {
+		// Tier layers of a base map are checked in base map coordinates
+		if result.MapName == condition.MapName || result.BaseMap == condition.MapName {
 			x, y, w, h := condition.Target[0], condition.Target[1], condition.Target[2], condition.Target[3]
-			if result.X >= x && result.X < x+w && result.Y >= y && result.Y < y+h {
+			curX, curY := calcFramePosition(result, condition.MapName)
+			if curX >= x && curX < x+w && curY >= y && curY < y+h {
 				log.Info().
 					Interface("expected", condition).
 					Msg("Location assertion satisfied")
@@ -145,7 +134,7 @@ func (r *MapTrackerAssertLocation) parseParam(paramStr string) (*MapTrackerAsser
 			return nil, fmt.Errorf("width and height in target must be positive for expected condition at index %d", i)
 		}
 	}
-	// Precision and Threshold will be validated in MapTrackerInfer, omitted here
+	// Precision, Threshold and MinMargin will be validated in MapTrackerInfer, omitted here
 
 	return &param, nil
 }
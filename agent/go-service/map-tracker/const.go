@@ -8,29 +8,186 @@ const (
 
 // Location inference configuration
 const (
-	// Mini-map crop area
-	LOC_CENTER_X = 108
-	LOC_CENTER_Y = 111
-	LOC_RADIUS   = 40
+	// Tracking mode search radius around the last known location (in map pixels)
+	TRACK_SEARCH_RADIUS = 24
+	// Tracking mode minimum confidence to accept a match without global search
+	TRACK_THRESHOLD = 0.6
+	// Maximum number of distinct candidates in the inference result
+	INFER_TOP_K = 5
+	// Candidates within this distance of a better one on the same base map are suppressed (in map pixels)
+	INFER_NMS_RADIUS = 20.0
 )
 
-// Rotation inference configuration
+// Map pyramid configuration
 const (
-	// Pointer crop area
-	ROT_CENTER_X = 108
-	ROT_CENTER_Y = 111
-	ROT_RADIUS   = 12
+	// Number of distinct coarse level peaks to keep on each map
+	PYRAMID_PEAKS_PER_MAP = 3
+	// Number of coarse level candidates to refine on finer levels
+	PYRAMID_CANDIDATES = 8
+	// Refine search radius around a projected candidate (in coarser level pixels)
+	PYRAMID_REFINE_RADIUS = 3
+)
+
+// Template matching configuration
+const (
+	// Needle size per coarse grid step at precision 0 (in needle pixels), halved at precision 1
+	MATCH_STEP_DIVISOR = 6.0
+	// Maximum coarse grid step (in needle pixels)
+	MATCH_MAX_STEP = 4
+	// Minimum number of coarse grid positions along each axis of a search region
+	MATCH_MIN_GRID = 4
+	// Score at which a match is certain and the search stops early
+	MATCH_CERTAIN_SCORE = 0.95
+	// Minimum number of coarse grid positions to spread a search over the worker pool
+	MATCH_PARALLEL_MIN_POSITIONS = 1024
+	// Number of CPUs left to the game when sizing the worker pool
+	MATCH_RESERVED_PROCS = 1
+	// Minimum value of a used pixel of a mask
+	MASK_THRESHOLD = 128
+	// Size of the tiles of FFT-based matching (in pixels), enlarged for needles larger than half of it
+	FFT_TILE_SIZE = 512
+	// Cost of an FFT butterfly relative to a multiply-accumulate of direct matching
+	FFT_COST_FACTOR = 6.0
+	// Search radius around the ground truth when comparing matching backends in replays (in level pixels)
+	FFT_CHECK_RADIUS = 256
+	// Stride of the positions compared between matching backends in replays
+	FFT_CHECK_STEP = 8
+)
+
+// Template matching backends
+const (
+	MATCH_BACKEND_AUTO   = "auto"
+	MATCH_BACKEND_DIRECT = "direct"
+	MATCH_BACKEND_FFT    = "fft"
+)
+
+// Map pyramid scales, from coarse to fine.
+// The precision of MapTrackerInfer selects the finest level to refine to.
+var PYRAMID_SCALES = []float64{0.25, 0.5, 1.0}
+
+// Feature relocalization configuration, features are extracted on original scale images
+const (
+	// Minimum intensity difference of the FAST corner test
+	FEATURE_FAST_THRESHOLD = 12
+	// Size of the grid cells limiting the corner density (in pixels)
+	FEATURE_GRID_CELL = 8
+	// Maximum number of corners kept in each grid cell
+	FEATURE_PER_CELL = 2
+	// Radius of the descriptor patch around a corner (in pixels)
+	FEATURE_PATCH_RADIUS = 8
+	// Radius of the box filter applied before computing descriptors (in pixels)
+	FEATURE_SMOOTH_RADIUS = 2
+	// Seed of the descriptor sampling pattern
+	FEATURE_PATTERN_SEED = 0x4d54
+	// Mini-map corners closer than this to the center are covered by the pointer (in pixels)
+	FEATURE_POINTER_EXCLUDE = 10.0
+	// Maximum Hamming distance of a descriptor match (of 256 bits)
+	FEATURE_MAX_HAMMING = 64
+	// Number of nearest map features each mini-map feature votes for
+	FEATURE_MATCHES_PER_POINT = 3
+	// Size of the translation voting bins (in pixels)
+	FEATURE_VOTE_BIN = 4
+	// Minimum number of votes of a translation candidate
+	FEATURE_MIN_VOTES = 4
+	// Maximum number of translation candidates to refine by template matching
+	FEATURE_CANDIDATES = 8
+)
+
+// Default mini-map geometry for the 1280x720 PC layout,
+// used if no geometry profile matches
+var DEFAULT_GEOMETRY = MinimapGeometry{
+	Minimap: GeometryCircle{X: 108, Y: 111, Radius: 40},
+	Pointer: GeometryCircle{X: 108, Y: 111, Radius: 12},
+	Scale:   1.0,
+}
+
+// Geometry profile configuration
+const (
+	CONTROLLER_WIN32 = "win32"
+	CONTROLLER_ADB   = "adb"
+	// Resource variant attached by the ADB controller, telling the controller type
+	ADB_RESOURCE_VARIANT = "resource_adb"
+	// Auto-calibration defaults
+	CALIBRATION_SEARCH       = 24
+	CALIBRATION_RADIUS_RANGE = 0.3
+	CALIBRATION_MIN_SCORE    = 0.08
+	// Number of sampled angles on a candidate circle
+	CALIBRATION_ANGLES = 64
+	// Distance between the inner and outer samples and the candidate circle (in pixels)
+	CALIBRATION_EDGE_WIDTH = 2
+	// Interval before retrying a failed calibration (in milliseconds), doubled after each failure
+	CALIBRATION_RETRY_INTERVAL_MS = 5000
+	// Number of failed calibrations after which the profile geometry is used without retrying
+	CALIBRATION_MAX_FAILURES = 5
 )
 
 // Resource paths
 const (
 	MAP_DIR      = "image/MapTracker/map"
 	POINTER_PATH = "image/MapTracker/pointer.png"
+	NAV_DIR      = "image/MapTracker/nav"
+	ROUTE_DIR    = "image/MapTracker/route"
+	POI_DIR      = "image/MapTracker/poi"
+	// Mini-map geometry profiles
+	GEOMETRY_PATH = "image/MapTracker/geometry.json"
 )
 
+// Output directory of debug files, relative to the working directory
+const DEBUG_DIR = "debug"
+
+// Precomputed map index cache
+const (
+	// Directory of the cache files, relative to the working directory
+	MAP_CACHE_DIR = "cache/map_tracker"
+	// Version of the cache file format, bump it whenever the cached data changes
+	MAP_CACHE_VERSION = 2
+)
+
+// Debug image layout
+const (
+	// Size of each panel of the inference debug image (in pixels)
+	DEBUG_PANEL_SIZE = 240
+	// Height of a text line (in pixels)
+	DEBUG_LINE_HEIGHT = 16
+	// Target size of the longer side of the trajectory debug image (in pixels)
+	DEBUG_TRACE_SIZE = 800
+	// Margin around the path and the trajectory (in map pixels)
+	DEBUG_TRACE_MARGIN = 20
+)
+
+// Map tile size in pixels (600px game tiles scaled by 0.1625, see map_tracker_merger.py)
+const MAP_TILE_SIZE = 97.5
+
 // Move action configuration
 const (
 	INFER_INTERVAL_MS = 200
+	// Duration of a stuck recovery maneuver (in milliseconds)
+	STUCK_MANEUVER_MS = 400
+	// Camera rotation of the rotate stuck recovery maneuvers (in degrees)
+	STUCK_ROTATE_ANGLE = 45
+	// Delay after a key press waypoint action (in milliseconds)
+	WAYPOINT_ACTION_DELAY_MS = 500
+	// Duration the screen must stay still for the wait_freeze waypoint action (in milliseconds)
+	WAYPOINT_FREEZE_MS = 500
+	// Number of failed inferences in a row before checking whether the map has changed
+	MAP_CHANGE_CHECK_MISSES = 5
+)
+
+// Transition screen detection, on the luminance of sampled screen pixels
+const (
+	// Sampling step of the screen pixels (in pixels)
+	SCREEN_SAMPLE_STEP = 8
+	// Maximum luminance of a dark pixel and minimum luminance of a bright pixel
+	SCREEN_DARK_LUMA   = 24.0
+	SCREEN_BRIGHT_LUMA = 232.0
+	// Minimum ratio of dark or bright pixels of a black or white screen
+	SCREEN_FILL_RATIO = 0.95
+)
+
+// Kinds of transition screens
+const (
+	SCREEN_BLACK = "black"
+	SCREEN_WHITE = "white"
 )
 
 // MapTrackerInfer parameters default values
@@ -38,6 +195,7 @@ var DEFAULT_INFERENCE_PARAM = MapTrackerInferParam{
 	MapNameRegex: "^map\\d+_lv\\d+$",
 	Precision:    0.4,
 	Threshold:    0.4,
+	Backend:      MATCH_BACKEND_AUTO,
 }
 
 // MapTrackerInfer parameters for MapTrackerMove action default values
@@ -45,6 +203,8 @@ var DEFAULT_INFERENCE_PARAM = MapTrackerInferParam{
 var DEFAULT_INFERENCE_PARAM_FOR_MOVE = MapTrackerInferParam{
 	Precision: 0.8,
 	Threshold: 0.4,
+	Track:     true,
+	Backend:   MATCH_BACKEND_AUTO,
 }
 
 // MapTrackerMove parameters default values
@@ -58,8 +218,149 @@ var DEFAULT_MOVING_PARAM = MapTrackerMoveParam{
 	SprintThreshold:        25.0,
 	StuckThreshold:         1500,
 	StuckTimeout:           10000,
+	StuckRecovery:          []string{STUCK_JUMP},
+	Recovery:               RECOVERY_NONE,
+	MaxRetries:             2,
+	OnFailure:              ON_FAILURE_STOP,
+	Steering:               STEERING_STEP,
+	Lookahead:              10.0,
+	MaxSpeed:               60.0,
+	TransitionTimeout:      60000,
+}
+
+// Rotation inference configuration
+const (
+	// Number of angle bins of the polar unwrap (3 degrees per bin)
+	ROT_POLAR_BINS = 120
+	// Radius range of the polar unwrap around the pointer center (in template pixels)
+	ROT_POLAR_MIN_RADIUS = 2.0
+	ROT_POLAR_MAX_RADIUS = 7.0
+	// Number of rings of the polar unwrap
+	ROT_POLAR_RINGS = 6
+	// Maximum offset of the pointer center from the patch center to search (in pixels)
+	ROT_CENTER_SEARCH = 1
+)
+
+// Motion filter configuration
+const (
+	// Standard deviation of an inferred location at full confidence (in map pixels)
+	MOTION_MEASURE_NOISE = 1.5
+	// Standard deviation of the player acceleration (in map pixels per second squared)
+	MOTION_ACCEL_NOISE = 30.0
+	// Initial variance of the velocity (in map pixels squared per second squared)
+	MOTION_INIT_SPEED_VAR = 400.0
+	// Extra distance allowed by the max-speed gate (in map pixels)
+	MOTION_GATE_SLACK = 8.0
+	// Number of rejections in a row after which the filter restarts
+	MOTION_MAX_REJECTIONS = 5
+	// Minimum speed to report a heading (in map pixels per second)
+	MOTION_MIN_SPEED = 3.0
+)
+
+// MapTrackerMove steering modes
+const (
+	// Stop-and-turn or turn by a fixed multiplier towards the next point (legacy behavior)
+	STEERING_STEP = "step"
+	// Pure pursuit of a lookahead point with a PID controller on heading
+	STEERING_PURSUIT = "pursuit"
+)
+
+// Pursuit steering configuration
+const (
+	// PID gains on the heading error (in degrees)
+	PURSUIT_KP = 0.8
+	PURSUIT_KI = 0.1
+	PURSUIT_KD = 0.05
+	// Limit of the integral term (in degree seconds)
+	PURSUIT_INTEGRAL_LIMIT = 30.0
+	// Minimum controller output to rotate the camera (in degrees)
+	PURSUIT_DEADBAND = 2.0
+	// Smoothing factor of the online camera sensitivity estimate
+	SENSITIVITY_EMA_ALPHA = 0.3
+	// Minimum observed rotation to update the sensitivity estimate (in degrees)
+	SENSITIVITY_MIN_DELTA = 4
+	// Maximum ratio between the sensitivity estimate and rotation_speed
+	SENSITIVITY_RANGE = 4.0
+)
+
+// MapTrackerRecord parameters default values
+var DEFAULT_RECORDING_PARAM = MapTrackerRecordParam{
+	Duration:    300000,
+	IdleTimeout: 5000,
+	MinDistance: 5.0,
+	TurnAngle:   20.0,
+	MaxSegment:  60.0,
 }
 
+// MapTrackerGeofence events
+const (
+	GEOFENCE_INSIDE = "inside"
+	GEOFENCE_ENTER  = "enter"
+	GEOFENCE_LEAVE  = "leave"
+	GEOFENCE_DWELL  = "dwell"
+	// Default hysteresis margin (in map pixels)
+	GEOFENCE_DEFAULT_MARGIN = 3.0
+)
+
+// POI categories
+const (
+	POI_TELEPORT = "teleport"
+	POI_RESOURCE = "resource"
+	POI_SHOP     = "shop"
+	POI_NPC      = "npc"
+	POI_OTHER    = "other"
+)
+
+// MapTrackerMove recovery strategies
+const (
+	RECOVERY_NONE     = "none"
+	RECOVERY_RETRY    = "retry"
+	RECOVERY_BACKOFF  = "backoff"
+	RECOVERY_REPLAN   = "replan"
+	RECOVERY_TELEPORT = "teleport"
+)
+
+// MapTrackerMove stuck recovery maneuvers
+const (
+	STUCK_JUMP         = "jump"
+	STUCK_JUMP_FORWARD = "jump_forward"
+	STUCK_STRAFE_LEFT  = "strafe_left"
+	STUCK_STRAFE_RIGHT = "strafe_right"
+	STUCK_BACKWARD     = "backward"
+	STUCK_ROTATE_LEFT  = "rotate_left"
+	STUCK_ROTATE_RIGHT = "rotate_right"
+)
+
+// MapTrackerMove waypoint actions
+const (
+	WAYPOINT_INTERACT    = "interact"
+	WAYPOINT_WAIT_FREEZE = "wait_freeze"
+	WAYPOINT_RUN_NODE    = "run_node"
+	WAYPOINT_SPRINT_OFF  = "sprint_off"
+	WAYPOINT_JUMP        = "jump"
+)
+
+// MapTrackerMove final failure behaviors
+const (
+	// Stop the whole task (legacy behavior)
+	ON_FAILURE_STOP = "stop"
+	// Fail the action so that the pipeline goes to on_error
+	ON_FAILURE_ERROR = "error"
+)
+
+// MapTrackerMove failure reasons
+const (
+	MOVE_FAILURE_ARRIVAL_TIMEOUT  = "arrival_timeout"
+	MOVE_FAILURE_ROTATION_TIMEOUT = "rotation_timeout"
+	MOVE_FAILURE_STUCK_TIMEOUT    = "stuck_timeout"
+	MOVE_FAILURE_ACTION           = "action_failed"
+	MOVE_FAILURE_STOPPING         = "stopping"
+	// The transition screen or the lost location lasted too long
+	MOVE_FAILURE_TRANSITION_TIMEOUT = "transition_timeout"
+	// The player is found on a map not expected by the path
+	MOVE_FAILURE_MAP_CHANGED = "map_changed"
+)
+
 // Win32 action related codes
 const (
 	KEY_W     = 0x57
@@ -70,4 +371,5 @@ const (
 	KEY_CTRL  = 0x11
 	KEY_ALT   = 0x12
 	KEY_SPACE = 0x20
+	KEY_F     = 0x46
 )
@@ -0,0 +1,319 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	debugColorBackground = color.RGBA{32, 32, 32, 255}
+	debugColorText       = color.RGBA{230, 230, 230, 255}
+	debugColorBest       = color.RGBA{255, 64, 64, 255}
+	debugColorCandidate  = color.RGBA{255, 208, 0, 255}
+	debugColorPath       = color.RGBA{64, 224, 64, 255}
+	debugColorActual     = color.RGBA{64, 160, 255, 255}
+	debugColorBar        = color.RGBA{160, 160, 160, 255}
+)
+
+// inferDebug collects the intermediate results of an inference for the debug image
+type inferDebug struct {
+	MiniMap image.Image
+	// RotScores are the rotation scores of every angle bin
+	RotScores []float64
+}
+
+// moveTrace records the actual positions during a MapTrackerMove run for the debug image
+type moveTrace struct {
+	Points []tracePoint
+}
+
+// tracePoint is one located position on the given map, where (RawX, RawY) is the inferred location
+// and (X, Y) is the location used for steering
+type tracePoint struct {
+	MapName    string
+	X, Y       int
+	RawX, RawY int
+	Rejected   bool
+}
+
+func (t *moveTrace) add(mapName string, x, y, rawX, rawY int, rejected bool) {
+	if t != nil {
+		t.Points = append(t.Points, tracePoint{mapName, x, y, rawX, rawY, rejected})
+	}
+}
+
+// writeInferDebug renders the annotated inference debug image into the debug directory.
+// Returns the path of the written file.
+func (i *MapTrackerInfer) writeInferDebug(dbg *inferDebug, result *MapTrackerInferResult) (string, error) {
+	const panel = DEBUG_PANEL_SIZE
+	lines := len(result.Candidates) + 1
+	canvas := image.NewRGBA(image.Rect(0, 0, panel*3, panel+DEBUG_LINE_HEIGHT*(lines+1)))
+	fillRect(canvas, canvas.Rect, debugColorBackground)
+
+	// Panel 1: the mini-map crop
+	if dbg.MiniMap != nil {
+		drawFit(canvas, image.Rect(0, 0, panel, panel), dbg.MiniMap, dbg.MiniMap.Bounds())
+	}
+	drawLabel(canvas, 4, 14, "minimap", debugColorText)
+
+	// Panel 2: the area of the best map around the match
+	if m := i.findMap(result.MapName); m != nil && dbg.MiniMap != nil {
+		mw, mh := dbg.MiniMap.Bounds().Dx(), dbg.MiniMap.Bounds().Dy()
+		view := image.Rect(result.X-mw*3/2, result.Y-mh*3/2, result.X+mw*3/2, result.Y+mh*3/2)
+		dst := image.Rect(panel, 0, panel*2, panel)
+		src := view.Sub(image.Pt(m.OffsetX, m.OffsetY))
+		fitted := drawFit(canvas, dst, m.Img, src)
+		toPanel := func(x, y int) image.Point {
+			return image.Pt(
+				fitted.Min.X+int(float64(x-view.Min.X)*float64(fitted.Dx())/float64(view.Dx())),
+				fitted.Min.Y+int(float64(y-view.Min.Y)*float64(fitted.Dy())/float64(view.Dy())),
+			)
+		}
+		for idx := len(result.Candidates) - 1; idx >= 0; idx-- {
+			c := result.Candidates[idx]
+			if c.MapName != result.MapName {
+				continue
+			}
+			col := debugColorCandidate
+			if idx == 0 {
+				col = debugColorBest
+			}
+			r := image.Rectangle{toPanel(c.X-mw/2, c.Y-mh/2), toPanel(c.X+mw/2, c.Y+mh/2)}
+			if r.Intersect(dst).Empty() {
+				continue
+			}
+			drawRect(canvas, r, col)
+			drawLabel(canvas, r.Min.X+2, r.Min.Y+12, fmt.Sprintf("#%d", idx+1), col)
+		}
+	}
+	drawLabel(canvas, panel+4, 14, fmt.Sprintf("%s (%d, %d)", result.MapName, result.X, result.Y), debugColorText)
+
+	// Panel 3: the rotation histogram
+	if n := len(dbg.RotScores); n > 0 {
+		barW := float64(panel-8) / float64(n)
+		best := 0
+		for idx, v := range dbg.RotScores {
+			if v > dbg.RotScores[best] {
+				best = idx
+			}
+		}
+		for idx, v := range dbg.RotScores {
+			h := int(math.Max(0, math.Min(1, v)) * float64(panel-40))
+			x0 := panel*2 + 4 + int(float64(idx)*barW)
+			x1 := panel*2 + 4 + int(float64(idx+1)*barW)
+			col := debugColorBar
+			if idx == best {
+				col = debugColorBest
+			}
+			fillRect(canvas, image.Rect(x0, panel-4-h, max(x1, x0+1), panel-4), col)
+		}
+	}
+	drawLabel(canvas, panel*2+4, 14, fmt.Sprintf("rot %.1f (%.3f)", result.RotF, result.RotConf), debugColorText)
+
+	// Text summary and candidate list
+	y := panel + DEBUG_LINE_HEIGHT
+	drawLabel(canvas, 4, y, fmt.Sprintf("locConf %.3f  rotConf %.3f  margin %.3f  tracked %v  relocalized %v", result.LocConf, result.RotConf, result.Margin, result.Tracked, result.Relocalized), debugColorText)
+	for idx, c := range result.Candidates {
+		y += DEBUG_LINE_HEIGHT
+		drawLabel(canvas, 4, y, fmt.Sprintf("#%d %s (%d, %d) %.3f", idx+1, c.MapName, c.X, c.Y, c.Conf), debugColorText)
+	}
+
+	return writeDebugImage(canvas, fmt.Sprintf("map_tracker_infer_%s.png", time.Now().Format("20060102_150405.000")))
+}
+
+// writeMoveDebug renders the planned path and the actual positions of a MapTrackerMove run
+// over the map image into the debug directory.
+// Only the parts of the path and the trajectory on the map of param.MapName are drawn.
+// Returns the path of the written file.
+func writeMoveDebug(param *MapTrackerMoveParam, trace *moveTrace, failure *MoveFailure) (string, error) {
+	mapPath := findResource(filepath.Join(MAP_DIR, param.MapName+".png"))
+	if mapPath == "" {
+		return "", fmt.Errorf("map image of %s not found", param.MapName)
+	}
+	file, err := os.Open(mapPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open map image: %w", err)
+	}
+	mapImg, _, err := image.Decode(file)
+	file.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to decode map image: %w", err)
+	}
+
+	// Waypoints and positions on the map
+	path := make([]Waypoint, 0, len(param.Path))
+	pathIndices := make([]int, 0, len(param.Path))
+	for idx, w := range param.Path {
+		if isSameBaseMap(param.waypointMap(idx), param.MapName) {
+			path = append(path, w)
+			pathIndices = append(pathIndices, idx)
+		}
+	}
+	points := make([]tracePoint, 0, len(trace.Points))
+	for _, p := range trace.Points {
+		if isSameBaseMap(p.MapName, param.MapName) {
+			points = append(points, p)
+		}
+	}
+
+	// Bounding box of the path and the trajectory
+	view := image.Rectangle{}
+	extend := func(x, y int) {
+		r := image.Rect(x, y, x+1, y+1)
+		if view.Empty() {
+			view = r
+		} else {
+			view = view.Union(r)
+		}
+	}
+	for _, w := range path {
+		extend(w.X, w.Y)
+	}
+	for _, p := range points {
+		extend(p.X, p.Y)
+		if p.Rejected {
+			extend(p.RawX, p.RawY)
+		}
+	}
+	view = view.Inset(-DEBUG_TRACE_MARGIN)
+
+	scale := math.Max(1, float64(DEBUG_TRACE_SIZE)/float64(max(view.Dx(), view.Dy())))
+	canvas := image.NewRGBA(image.Rect(0, 0, int(float64(view.Dx())*scale), int(float64(view.Dy())*scale)+DEBUG_LINE_HEIGHT*2))
+	fillRect(canvas, canvas.Rect, debugColorBackground)
+	xdraw.NearestNeighbor.Scale(canvas, image.Rect(0, 0, canvas.Rect.Dx(), canvas.Rect.Dy()-DEBUG_LINE_HEIGHT*2), mapImg, view, xdraw.Over, nil)
+	toCanvas := func(x, y int) image.Point {
+		return image.Pt(int((float64(x-view.Min.X)+0.5)*scale), int((float64(y-view.Min.Y)+0.5)*scale))
+	}
+
+	// Planned path
+	for idx, w := range path {
+		p := toCanvas(w.X, w.Y)
+		if idx > 0 && pathIndices[idx-1] == pathIndices[idx]-1 {
+			drawLine(canvas, toCanvas(path[idx-1].X, path[idx-1].Y), p, debugColorPath)
+		}
+		drawRect(canvas, image.Rect(p.X-3, p.Y-3, p.X+4, p.Y+4), debugColorPath)
+		drawLabel(canvas, p.X+5, p.Y-4, fmt.Sprintf("%d", pathIndices[idx]), debugColorPath)
+	}
+
+	// Actual positions, and the inferred locations rejected by the motion filter
+	for idx, tp := range points {
+		p := toCanvas(tp.X, tp.Y)
+		if idx > 0 {
+			drawLine(canvas, toCanvas(points[idx-1].X, points[idx-1].Y), p, debugColorActual)
+		}
+		fillRect(canvas, image.Rect(p.X-1, p.Y-1, p.X+2, p.Y+2), debugColorActual)
+		if tp.Rejected {
+			r := toCanvas(tp.RawX, tp.RawY)
+			drawLine(canvas, image.Pt(r.X-3, r.Y-3), image.Pt(r.X+3, r.Y+3), debugColorBest)
+			drawLine(canvas, image.Pt(r.X-3, r.Y+3), image.Pt(r.X+3, r.Y-3), debugColorBest)
+		}
+	}
+
+	summary := fmt.Sprintf("%s  waypoints %d  positions %d  finished", param.MapName, len(param.Path), len(trace.Points))
+	if failure != nil {
+		summary = fmt.Sprintf("%s  waypoints %d  positions %d  failed: %s at #%d", param.MapName, len(param.Path), len(trace.Points), failure.Reason, failure.Index)
+		if failure.Located && isSameBaseMap(failure.MapName, param.MapName) {
+			p := toCanvas(failure.X, failure.Y)
+			drawRect(canvas, image.Rect(p.X-5, p.Y-5, p.X+6, p.Y+6), debugColorBest)
+		}
+	}
+	drawLabel(canvas, 4, canvas.Rect.Dy()-DEBUG_LINE_HEIGHT/2, summary, debugColorText)
+
+	return writeDebugImage(canvas, fmt.Sprintf("map_tracker_move_%s_%s.png", param.MapName, time.Now().Format("20060102_150405.000")))
+}
+
+// writeDebugImage encodes the image as PNG into the debug directory
+func writeDebugImage(img image.Image, name string) (string, error) {
+	if err := os.MkdirAll(DEBUG_DIR, 0755); err != nil {
+		return "", fmt.Errorf("failed to create debug directory: %w", err)
+	}
+	outPath := filepath.Join(DEBUG_DIR, name)
+	file, err := os.Create(outPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create debug image: %w", err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		return "", fmt.Errorf("failed to encode debug image: %w", err)
+	}
+	return outPath, nil
+}
+
+// drawFit scales the source rect of src into dst keeping the aspect ratio.
+// Returns the rect that was actually drawn to.
+func drawFit(canvas *image.RGBA, dst image.Rectangle, src image.Image, sr image.Rectangle) image.Rectangle {
+	scale := math.Min(float64(dst.Dx())/float64(sr.Dx()), float64(dst.Dy())/float64(sr.Dy()))
+	w, h := int(float64(sr.Dx())*scale), int(float64(sr.Dy())*scale)
+	r := image.Rect(0, 0, w, h).Add(dst.Min).Add(image.Pt((dst.Dx()-w)/2, (dst.Dy()-h)/2))
+	xdraw.NearestNeighbor.Scale(canvas, r, src, sr, xdraw.Over, nil)
+	return r
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	r = r.Intersect(img.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+func drawRect(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	fillRect(img, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+1), c)
+	fillRect(img, image.Rect(r.Min.X, r.Max.Y-1, r.Max.X, r.Max.Y), c)
+	fillRect(img, image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Max.Y), c)
+	fillRect(img, image.Rect(r.Max.X-1, r.Min.Y, r.Max.X, r.Max.Y), c)
+}
+
+// drawLine draws a line using Bresenham's algorithm
+func drawLine(img *image.RGBA, a, b image.Point, c color.RGBA) {
+	dx, dy := absInt(b.X-a.X), -absInt(b.Y-a.Y)
+	sx, sy := 1, 1
+	if a.X > b.X {
+		sx = -1
+	}
+	if a.Y > b.Y {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		if a.In(img.Rect) {
+			img.SetRGBA(a.X, a.Y, c)
+		}
+		if a == b {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			a.X += sx
+		}
+		if e2 <= dx {
+			e += dx
+			a.Y += sy
+		}
+	}
+}
+
+// drawLabel draws a text label with its baseline at (x, y)
+func drawLabel(img *image.RGBA, x, y int, text string, c color.RGBA) {
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
@@ -0,0 +1,345 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+)
+
+// featurePoint is the position of a keypoint in image coordinates
+type featurePoint struct {
+	X, Y int32
+}
+
+// featureDesc is a 256-bit binary descriptor of a keypoint
+type featureDesc [4]uint64
+
+// mapFeatures holds the keypoints of an image and their descriptors, in the same order
+type mapFeatures struct {
+	Points []featurePoint
+	Descs  []featureDesc
+}
+
+// fastCircle is the Bresenham circle of radius 3 used by the FAST corner test
+var fastCircle = [16][2]int{
+	{0, -3}, {1, -3}, {2, -2}, {3, -1}, {3, 0}, {3, 1}, {2, 2}, {1, 3},
+	{0, 3}, {-1, 3}, {-2, 2}, {-3, 1}, {-3, 0}, {-3, -1}, {-2, -2}, {-1, -3},
+}
+
+// briefPattern is the fixed list of point pairs compared by the descriptor,
+// sampled from an isotropic Gaussian around the keypoint with a fixed seed.
+// Changing it invalidates the map cache, so MAP_CACHE_VERSION must be bumped along.
+var briefPattern = func() [256][4]int {
+	var pattern [256][4]int
+	rng := rand.New(rand.NewPCG(FEATURE_PATTERN_SEED, FEATURE_PATTERN_SEED))
+	sample := func() int {
+		v := int(math.Round(rng.NormFloat64() * FEATURE_PATCH_RADIUS / 2))
+		return min(max(v, -FEATURE_PATCH_RADIUS), FEATURE_PATCH_RADIUS)
+	}
+	for idx := range pattern {
+		pattern[idx] = [4]int{sample(), sample(), sample(), sample()}
+	}
+	return pattern
+}()
+
+// extractFeatures detects FAST corners on the image and computes their BRIEF-like descriptors.
+// Corners are kept if keep returns true for them, or all corners if keep is nil,
+// and at most FEATURE_PER_CELL of the strongest corners are kept per FEATURE_GRID_CELL cell.
+func extractFeatures(img *image.RGBA, keep func(x, y int) bool) mapFeatures {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	border := FEATURE_PATCH_RADIUS + FEATURE_SMOOTH_RADIUS
+	if w <= border*2 || h <= border*2 {
+		return mapFeatures{}
+	}
+
+	// Convert to grayscale
+	gray := make([]int32, w*h)
+	for y := 0; y < h; y++ {
+		row := img.Pix[img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			o := x * 4
+			gray[y*w+x] = (int32(row[o])*77 + int32(row[o+1])*150 + int32(row[o+2])*29) >> 8
+		}
+	}
+
+	// Score FAST corners, then keep the local maxima
+	scores := make([]int32, w*h)
+	for y := border; y < h-border; y++ {
+		for x := border; x < w-border; x++ {
+			scores[y*w+x] = fastScore(gray, w, x, y)
+		}
+	}
+	type corner struct {
+		x, y  int
+		score int32
+	}
+	cells := make(map[int][]corner)
+	cellCols := (w + FEATURE_GRID_CELL - 1) / FEATURE_GRID_CELL
+	for y := border; y < h-border; y++ {
+		for x := border; x < w-border; x++ {
+			s := scores[y*w+x]
+			if s == 0 || (keep != nil && !keep(x, y)) {
+				continue
+			}
+			isMax := true
+			for dy := -1; dy <= 1 && isMax; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					o := scores[(y+dy)*w+x+dx]
+					// Break ties by position so that plateaus keep exactly one corner
+					if o > s || (o == s && (dy < 0 || (dy == 0 && dx < 0))) {
+						isMax = false
+						break
+					}
+				}
+			}
+			if isMax {
+				cell := (y/FEATURE_GRID_CELL)*cellCols + x/FEATURE_GRID_CELL
+				cells[cell] = append(cells[cell], corner{x, y, s})
+			}
+		}
+	}
+
+	// Keep the strongest corners of each cell, in cell order
+	corners := make([]corner, 0, len(cells)*FEATURE_PER_CELL)
+	cellIDs := make([]int, 0, len(cells))
+	for cell := range cells {
+		cellIDs = append(cellIDs, cell)
+	}
+	slices.Sort(cellIDs)
+	for _, cell := range cellIDs {
+		list := cells[cell]
+		slices.SortStableFunc(list, func(a, b corner) int { return int(b.score - a.score) })
+		corners = append(corners, list[:min(len(list), FEATURE_PER_CELL)]...)
+	}
+
+	// Describe the corners on the box-smoothed image
+	smooth := newBoxSum(gray, w, h, FEATURE_SMOOTH_RADIUS)
+	f := mapFeatures{
+		Points: make([]featurePoint, len(corners)),
+		Descs:  make([]featureDesc, len(corners)),
+	}
+	for idx, c := range corners {
+		f.Points[idx] = featurePoint{int32(c.x), int32(c.y)}
+		var d featureDesc
+		for b, p := range briefPattern {
+			if smooth[(c.y+p[1])*w+c.x+p[0]] < smooth[(c.y+p[3])*w+c.x+p[2]] {
+				d[b>>6] |= 1 << (b & 63)
+			}
+		}
+		f.Descs[idx] = d
+	}
+	return f
+}
+
+// fastScore returns the FAST-9 corner score of the pixel at (x, y), or 0 if it is not a corner.
+// The score is the sum of the absolute differences exceeding the threshold on the corner side.
+func fastScore(gray []int32, w, x, y int) int32 {
+	c := gray[y*w+x]
+	var ring [16]int32
+	for k, o := range fastCircle {
+		ring[k] = gray[(y+o[1])*w+x+o[0]] - c
+	}
+
+	// Any arc of 9 contains at least two of the four compass points
+	bright, dark := 0, 0
+	for k := 0; k < 16; k += 4 {
+		if ring[k] > FEATURE_FAST_THRESHOLD {
+			bright++
+		} else if ring[k] < -FEATURE_FAST_THRESHOLD {
+			dark++
+		}
+	}
+	if bright < 2 && dark < 2 {
+		return 0
+	}
+
+	for _, sign := range [2]int32{1, -1} {
+		run := 0
+		for k := 0; k < 16+9; k++ {
+			if ring[k%16]*sign > FEATURE_FAST_THRESHOLD {
+				run++
+				if run >= 9 {
+					var score int32
+					for _, v := range ring {
+						if v*sign > FEATURE_FAST_THRESHOLD {
+							score += v*sign - FEATURE_FAST_THRESHOLD
+						}
+					}
+					return score
+				}
+			} else {
+				run = 0
+			}
+		}
+	}
+	return 0
+}
+
+// newBoxSum returns the sums of the (2r+1)x(2r+1) box around every pixel,
+// where pixels outside of the image are ignored
+func newBoxSum(gray []int32, w, h, r int) []int32 {
+	stride := w + 1
+	integral := make([]int32, stride*(h+1))
+	for y := 0; y < h; y++ {
+		var rowSum int32
+		for x := 0; x < w; x++ {
+			rowSum += gray[y*w+x]
+			integral[(y+1)*stride+x+1] = integral[y*stride+x+1] + rowSum
+		}
+	}
+	sums := make([]int32, w*h)
+	for y := 0; y < h; y++ {
+		y0, y1 := max(y-r, 0), min(y+r+1, h)
+		for x := 0; x < w; x++ {
+			x0, x1 := max(x-r, 0), min(x+r+1, w)
+			sums[y*w+x] = integral[y1*stride+x1] - integral[y0*stride+x1] - integral[y1*stride+x0] + integral[y0*stride+x0]
+		}
+	}
+	return sums
+}
+
+// extractMinimapFeatures extracts the features of the mini-map, keeping only the corners
+// whose descriptor patches lie within the circular mini-map and away from the player pointer,
+// and which are inside the mask if it is not nil
+func extractMinimapFeatures(miniMap *image.RGBA, mask *image.Gray) mapFeatures {
+	w, h := miniMap.Rect.Dx(), miniMap.Rect.Dy()
+	cx, cy := float64(w)/2, float64(h)/2
+	outer := math.Min(cx, cy) - FEATURE_PATCH_RADIUS - FEATURE_SMOOTH_RADIUS
+	if mask != nil {
+		mask = scaleMask(mask, w, h)
+	}
+	return extractFeatures(miniMap, func(x, y int) bool {
+		if mask != nil && mask.Pix[y*mask.Stride+x] < MASK_THRESHOLD {
+			return false
+		}
+		d := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy)
+		return d <= outer && d >= FEATURE_POINTER_EXCLUDE
+	})
+}
+
+// featureVote is a translation of the query image onto a map voted by feature matches,
+// where (X, Y) is the top-left position of the query in the original level coordinates
+type featureVote struct {
+	Map   *MapCache
+	X, Y  int
+	Votes int
+}
+
+// voteFeatureTranslations matches every query feature with its FEATURE_MATCHES_PER_POINT nearest
+// map features by Hamming distance, and lets each match vote for the translation it implies.
+// Votes are accumulated in bins of FEATURE_VOTE_BIN pixels and summed over neighboring bins.
+// Returns up to FEATURE_CANDIDATES distinct translations with at least FEATURE_MIN_VOTES votes, most voted first.
+func voteFeatureTranslations(query mapFeatures, maps []*MapCache) []featureVote {
+	if len(query.Points) == 0 {
+		return nil
+	}
+
+	type match struct {
+		mapIdx, pointIdx int
+		dist             int
+	}
+	type bin struct {
+		mapIdx, bx, by int
+	}
+	votes := make(map[bin]int)
+	best := make([]match, 0, FEATURE_MATCHES_PER_POINT+1)
+	for q, qd := range query.Descs {
+		best = best[:0]
+		worst := FEATURE_MAX_HAMMING
+		for m, mapData := range maps {
+			for p, d := range mapData.Features.Descs {
+				dist := bits.OnesCount64(qd[0]^d[0]) + bits.OnesCount64(qd[1]^d[1]) +
+					bits.OnesCount64(qd[2]^d[2]) + bits.OnesCount64(qd[3]^d[3])
+				if dist > worst {
+					continue
+				}
+				// Insert into the sorted list of the nearest matches
+				pos := len(best)
+				for pos > 0 && best[pos-1].dist > dist {
+					pos--
+				}
+				best = slices.Insert(best, pos, match{m, p, dist})
+				if len(best) > FEATURE_MATCHES_PER_POINT {
+					best = best[:FEATURE_MATCHES_PER_POINT]
+				}
+				if len(best) == FEATURE_MATCHES_PER_POINT {
+					worst = best[len(best)-1].dist
+				}
+			}
+		}
+		qp := query.Points[q]
+		for _, b := range best {
+			mp := maps[b.mapIdx].Features.Points[b.pointIdx]
+			tx, ty := int(mp.X-qp.X), int(mp.Y-qp.Y)
+			votes[bin{b.mapIdx, floorDiv(tx, FEATURE_VOTE_BIN), floorDiv(ty, FEATURE_VOTE_BIN)}]++
+		}
+	}
+
+	// Sum votes over neighboring bins to tolerate translations on bin borders
+	type peak struct {
+		bin
+		score int
+	}
+	peaks := make([]peak, 0, len(votes))
+	for b := range votes {
+		score := 0
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				score += votes[bin{b.mapIdx, b.bx + dx, b.by + dy}]
+			}
+		}
+		if score >= FEATURE_MIN_VOTES {
+			peaks = append(peaks, peak{b, score})
+		}
+	}
+	slices.SortFunc(peaks, func(a, b peak) int {
+		if a.score != b.score {
+			return b.score - a.score
+		}
+		if a.mapIdx != b.mapIdx {
+			return a.mapIdx - b.mapIdx
+		}
+		if a.by != b.by {
+			return a.by - b.by
+		}
+		return a.bx - b.bx
+	})
+
+	// Greedily keep the peaks apart from the kept ones
+	result := make([]featureVote, 0, FEATURE_CANDIDATES)
+	kept := make([]bin, 0, FEATURE_CANDIDATES)
+	for _, p := range peaks {
+		suppressed := false
+		for _, k := range kept {
+			if k.mapIdx == p.mapIdx && absInt(k.bx-p.bx) <= 2 && absInt(k.by-p.by) <= 2 {
+				suppressed = true
+				break
+			}
+		}
+		if suppressed {
+			continue
+		}
+		kept = append(kept, p.bin)
+		result = append(result, featureVote{
+			Map:   maps[p.mapIdx],
+			X:     p.bx*FEATURE_VOTE_BIN + FEATURE_VOTE_BIN/2,
+			Y:     p.by*FEATURE_VOTE_BIN + FEATURE_VOTE_BIN/2,
+			Votes: p.score,
+		})
+		if len(result) == FEATURE_CANDIDATES {
+			break
+		}
+	}
+	return result
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,299 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/MaaXYZ/maa-framework-go/v4"
+	"github.com/rs/zerolog/log"
+)
+
+type MapTrackerGeofence struct{}
+
+// GeofenceZone is a named area on a map. Exactly one of Polygon, Circle and Rect is required.
+type GeofenceZone struct {
+	// Name is the zone name reported in the result (required).
+	Name string `json:"name"`
+	// MapName is the map of the zone (required). Tier layers of a base map are checked in base map coordinates.
+	MapName string `json:"map_name"`
+	// Polygon is the list of [x, y] vertices of a polygon zone.
+	Polygon [][2]int `json:"polygon,omitempty"`
+	// Circle is the [x, y, radius] of a circle zone.
+	Circle *[3]int `json:"circle,omitempty"`
+	// Rect is the [x, y, w, h] of a rectangle zone.
+	Rect *[4]int `json:"rect,omitempty"`
+}
+
+// MapTrackerGeofenceParam represents the custom_recognition_param for MapTrackerGeofence
+type MapTrackerGeofenceParam struct {
+	// Zones is the list of zones to check (required).
+	Zones []GeofenceZone `json:"zones"`
+	// Event is the event to hit on, one of "inside", "enter", "leave" and "dwell".
+	Event string `json:"event,omitempty"`
+	// Dwell is the time in milliseconds to stay inside a zone for the "dwell" event.
+	Dwell int64 `json:"dwell,omitempty"`
+	// Margin is the hysteresis distance a player inside a zone must go beyond its border to leave it.
+	Margin float64 `json:"margin,omitempty"`
+	// Precision controls the inference precision/speed tradeoff.
+	Precision float64 `json:"precision,omitempty"`
+	// Threshold controls the minimum confidence required to consider the inference successful.
+	Threshold float64 `json:"threshold,omitempty"`
+}
+
+// MapTrackerGeofenceResult is the detail of a geofence hit
+type MapTrackerGeofenceResult struct {
+	// Zone is the name of the first zone that triggered the event.
+	Zone string `json:"zone"`
+	// Zones is the names of all zones that triggered the event.
+	Zones []string `json:"zones"`
+	// Event is the event that was hit.
+	Event string `json:"event"`
+	// MapName, X and Y are the location of the player, in the coordinates of the zone map.
+	MapName string `json:"mapName"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+}
+
+// geofenceKey identifies the state of a zone checked by a node of a tasker
+type geofenceKey struct {
+	tasker maa.Tasker
+	node   string
+	zone   string
+}
+
+// geofenceState is the hysteresis state of a zone
+type geofenceState struct {
+	inside bool
+	since  time.Time
+}
+
+var (
+	geofenceMu     sync.Mutex
+	geofenceStates = make(map[geofenceKey]*geofenceState)
+)
+
+var _ maa.CustomRecognitionRunner = &MapTrackerGeofence{}
+
+// Run implements maa.CustomRecognitionRunner
+func (r *MapTrackerGeofence) Run(ctx *maa.Context, arg *maa.CustomRecognitionArg) (*maa.CustomRecognitionResult, bool) {
+	param, err := r.parseParam(arg.CustomRecognitionParam)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse parameters for MapTrackerGeofence")
+		return nil, false
+	}
+
+	// Run MapTrackerInfer on the zone maps only
+	mapNames := make([]string, 0, len(param.Zones))
+	for _, zone := range param.Zones {
+		mapNames = append(mapNames, zone.MapName)
+	}
+	nodeName := "MapTrackerGeofence_Infer"
+	config := map[string]any{
+		nodeName: map[string]any{
+			"recognition":        "Custom",
+			"custom_recognition": "MapTrackerInfer",
+			"custom_recognition_param": map[string]any{
+				"map_name_regex": calcMapNamesRegex(mapNames),
+				"precision":      param.Precision,
+				"threshold":      param.Threshold,
+				"track":          true,
+			},
+		},
+	}
+	res, err := ctx.RunRecognition(nodeName, arg.Img, config)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to run MapTrackerInfer for geofence")
+		return nil, false
+	}
+	if res == nil || !res.Hit || res.DetailJson == "" {
+		// Keep the zone states unchanged when the location is unknown
+		log.Debug().Msg("Geofence location not inferred")
+		return nil, false
+	}
+	result, err := parseInferDetail(res.DetailJson)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse inference result")
+		return nil, false
+	}
+
+	now := time.Now()
+	tasker := *ctx.GetTasker()
+	hit := MapTrackerGeofenceResult{Event: param.Event}
+
+	geofenceMu.Lock()
+	for _, zone := range param.Zones {
+		var dist float64
+		var x, y int
+		if result.MapName == zone.MapName || result.BaseMap == zone.MapName {
+			x, y = calcFramePosition(result, zone.MapName)
+			dist = zone.signedDistance(x, y)
+		} else {
+			// Player is on another map
+			dist = math.Inf(1)
+		}
+
+		key := geofenceKey{tasker, arg.CurrentTaskName, zone.Name}
+		state, known := geofenceStates[key]
+		if !known {
+			state = &geofenceState{inside: dist <= 0, since: now}
+			geofenceStates[key] = state
+		}
+
+		// Apply hysteresis on leaving
+		wasInside := state.inside
+		if wasInside && dist > param.Margin {
+			state.inside, state.since = false, now
+		} else if !wasInside && dist <= 0 {
+			state.inside, state.since = true, now
+		}
+
+		triggered := false
+		switch param.Event {
+		case GEOFENCE_INSIDE:
+			triggered = state.inside
+		case GEOFENCE_ENTER:
+			triggered = known && !wasInside && state.inside
+		case GEOFENCE_LEAVE:
+			triggered = known && wasInside && !state.inside
+		case GEOFENCE_DWELL:
+			triggered = state.inside && now.Sub(state.since).Milliseconds() >= param.Dwell
+		}
+		if triggered {
+			if len(hit.Zones) == 0 {
+				hit.Zone, hit.MapName, hit.X, hit.Y = zone.Name, zone.MapName, x, y
+			}
+			hit.Zones = append(hit.Zones, zone.Name)
+		}
+	}
+	geofenceMu.Unlock()
+
+	if len(hit.Zones) == 0 {
+		return nil, false
+	}
+
+	detail, err := json.Marshal(hit)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal geofence result")
+		return nil, false
+	}
+	log.Info().Str("zone", hit.Zone).Str("event", hit.Event).Int("x", hit.X).Int("y", hit.Y).Msg("Geofence triggered")
+	return &maa.CustomRecognitionResult{
+		Box:    arg.Roi,
+		Detail: string(detail),
+	}, true
+}
+
+func (r *MapTrackerGeofence) parseParam(paramStr string) (*MapTrackerGeofenceParam, error) {
+	var param MapTrackerGeofenceParam
+	if paramStr != "" {
+		if err := json.Unmarshal([]byte(paramStr), &param); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal parameters: %w", err)
+		}
+	}
+
+	if len(param.Zones) == 0 {
+		return nil, fmt.Errorf("zones must be provided")
+	}
+	names := make(map[string]struct{}, len(param.Zones))
+	for i, zone := range param.Zones {
+		if zone.Name == "" {
+			return nil, fmt.Errorf("name must be provided for zone at index %d", i)
+		}
+		if _, exists := names[zone.Name]; exists {
+			return nil, fmt.Errorf("duplicate zone name %s", zone.Name)
+		}
+		names[zone.Name] = struct{}{}
+		if zone.MapName == "" {
+			return nil, fmt.Errorf("map_name must be provided for zone %s", zone.Name)
+		}
+
+		shapes := 0
+		if len(zone.Polygon) > 0 {
+			shapes++
+			if len(zone.Polygon) < 3 {
+				return nil, fmt.Errorf("polygon must have at least 3 vertices for zone %s", zone.Name)
+			}
+		}
+		if zone.Circle != nil {
+			shapes++
+			if zone.Circle[2] <= 0 {
+				return nil, fmt.Errorf("circle radius must be positive for zone %s", zone.Name)
+			}
+		}
+		if zone.Rect != nil {
+			shapes++
+			if zone.Rect[2] <= 0 || zone.Rect[3] <= 0 {
+				return nil, fmt.Errorf("rect width and height must be positive for zone %s", zone.Name)
+			}
+		}
+		if shapes != 1 {
+			return nil, fmt.Errorf("exactly one of polygon, circle and rect is required for zone %s", zone.Name)
+		}
+	}
+
+	switch param.Event {
+	case "":
+		param.Event = GEOFENCE_INSIDE
+	case GEOFENCE_INSIDE, GEOFENCE_ENTER, GEOFENCE_LEAVE:
+	case GEOFENCE_DWELL:
+		if param.Dwell <= 0 {
+			return nil, fmt.Errorf("dwell must be positive for event %q", param.Event)
+		}
+	default:
+		return nil, fmt.Errorf("unknown event %q", param.Event)
+	}
+
+	if param.Margin < 0 {
+		return nil, fmt.Errorf("margin must be non-negative")
+	} else if param.Margin == 0 {
+		param.Margin = GEOFENCE_DEFAULT_MARGIN
+	}
+	// Precision and Threshold will be validated in MapTrackerInfer, omitted here
+
+	return &param, nil
+}
+
+// signedDistance returns the distance from (x, y) to the zone border,
+// negative inside the zone and positive outside
+func (z *GeofenceZone) signedDistance(x, y int) float64 {
+	px, py := float64(x), float64(y)
+	if z.Circle != nil {
+		return math.Hypot(px-float64(z.Circle[0]), py-float64(z.Circle[1])) - float64(z.Circle[2])
+	}
+
+	polygon := z.Polygon
+	if z.Rect != nil {
+		rx, ry, rw, rh := z.Rect[0], z.Rect[1], z.Rect[2], z.Rect[3]
+		polygon = [][2]int{{rx, ry}, {rx + rw, ry}, {rx + rw, ry + rh}, {rx, ry + rh}}
+	}
+
+	// Ray casting for the inside test, and the nearest edge for the distance
+	inside := false
+	minDist := math.Inf(1)
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		ax, ay := float64(polygon[j][0]), float64(polygon[j][1])
+		bx, by := float64(polygon[i][0]), float64(polygon[i][1])
+		if (by > py) != (ay > py) && px < (ax-bx)*(py-by)/(ay-by)+bx {
+			inside = !inside
+		}
+		minDist = min(minDist, calcSegmentDistance(px, py, ax, ay, bx, by))
+	}
+	if inside {
+		return -minDist
+	}
+	return minDist
+}
+
+// calcSegmentDistance returns the distance from (px, py) to the segment from (ax, ay) to (bx, by)
+func calcSegmentDistance(px, py, ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if l2 := dx*dx + dy*dy; l2 > 0 {
+		t = max(0, min(1, ((px-ax)*dx+(py-ay)*dy)/l2))
+	}
+	return math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
@@ -0,0 +1,366 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/MaaXYZ/maa-framework-go/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// GeometryCircle is a circular area on the 1280x720 screen
+type GeometryCircle struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Radius int `json:"radius"`
+}
+
+// MinimapGeometry describes where the mini-map and the player pointer are on the 1280x720 screen
+type MinimapGeometry struct {
+	// Minimap is the mini-map area to crop for location inference.
+	Minimap GeometryCircle `json:"minimap"`
+	// Pointer is the pointer area to crop for rotation inference.
+	Pointer GeometryCircle `json:"pointer"`
+	// Scale is the size of one map pixel on screen. Crops are rescaled by 1/Scale before matching.
+	Scale float64 `json:"scale,omitempty"`
+	// Mask is the resource path of an optional mask image of the mini-map crop, e.g. to hide UI overlays.
+	// Its opaque bright pixels are matched, and it is stretched to the size of the crop.
+	Mask string `json:"mask,omitempty"`
+}
+
+// GeometryCalibration configures the auto-calibration which finds the mini-map border circle
+type GeometryCalibration struct {
+	// BorderRadius is the nominal radius of the mini-map border of the profile geometry (required).
+	BorderRadius int `json:"border_radius"`
+	// Search is the maximum offset of the border center from the nominal mini-map center.
+	Search int `json:"search,omitempty"`
+	// RadiusRange is the relative range of border radii to search around BorderRadius.
+	RadiusRange float64 `json:"radius_range,omitempty"`
+	// MinScore is the minimum edge score to accept a calibration.
+	MinScore float64 `json:"min_score,omitempty"`
+}
+
+// GeometryProfile is a mini-map geometry profile, selected by controller type and resource variant
+type GeometryProfile struct {
+	// Name is the profile name.
+	Name string `json:"name"`
+	// Controller is the controller type to apply to, "win32" or "adb". Any if empty.
+	Controller string `json:"controller,omitempty"`
+	// Variant is the resource variant directory name to apply to, e.g. "resource_en". Any if empty.
+	Variant string `json:"variant,omitempty"`
+	MinimapGeometry
+	// Calibration enables the auto-calibration if set.
+	Calibration *GeometryCalibration `json:"calibration,omitempty"`
+}
+
+// geometryProfiles is the geometry profile resource
+type geometryProfiles struct {
+	Profiles []GeometryProfile `json:"profiles"`
+}
+
+// scale returns the effective scale of the geometry
+func (g *MinimapGeometry) scale() float64 {
+	if g.Scale <= 0 {
+		return 1.0
+	}
+	return g.Scale
+}
+
+// cropMinimap crops the mini-map area from the screen, in map pixel scale
+func (g *MinimapGeometry) cropMinimap(img image.Image) image.Image {
+	return scaleImage(cropArea(img, g.Minimap.X, g.Minimap.Y, g.Minimap.Radius), 1.0/g.scale())
+}
+
+// cropPointer crops the pointer area from the screen, in map pixel scale
+func (g *MinimapGeometry) cropPointer(img image.Image) image.Image {
+	return scaleImage(cropArea(img, g.Pointer.X, g.Pointer.Y, g.Pointer.Radius), 1.0/g.scale())
+}
+
+// loadGeometryProfiles loads the geometry profiles from the resource directory
+func loadGeometryProfiles() ([]GeometryProfile, error) {
+	path := findResource(GEOMETRY_PATH)
+	if path == "" {
+		return nil, fmt.Errorf("geometry profiles not found")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read geometry profiles: %w", err)
+	}
+	var res geometryProfiles
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal geometry profiles: %w", err)
+	}
+	for idx, p := range res.Profiles {
+		if p.Minimap.Radius <= 0 || p.Pointer.Radius <= 0 {
+			return nil, fmt.Errorf("profile %q has non-positive radius", p.Name)
+		}
+		if p.Calibration != nil && p.Calibration.BorderRadius <= 0 {
+			return nil, fmt.Errorf("profile %q has non-positive border_radius", p.Name)
+		}
+		if p.Controller != "" && p.Controller != CONTROLLER_WIN32 && p.Controller != CONTROLLER_ADB {
+			return nil, fmt.Errorf("profile %q has unknown controller %q", p.Name, p.Controller)
+		}
+		if c := res.Profiles[idx].Calibration; c != nil {
+			if c.Search <= 0 {
+				c.Search = CALIBRATION_SEARCH
+			}
+			if c.RadiusRange <= 0 {
+				c.RadiusRange = CALIBRATION_RADIUS_RANGE
+			}
+			if c.MinScore <= 0 {
+				c.MinScore = CALIBRATION_MIN_SCORE
+			}
+		}
+	}
+	return res.Profiles, nil
+}
+
+// selectGeometryProfile returns the most specific profile matching the controller type and
+// resource variants, preferring earlier profiles on ties. Returns nil if none matches.
+func selectGeometryProfile(profiles []GeometryProfile, controller string, variants []string) *GeometryProfile {
+	var best *GeometryProfile
+	bestScore := -1
+	for idx := range profiles {
+		p := &profiles[idx]
+		score := 0
+		if p.Controller != "" {
+			if p.Controller != controller {
+				continue
+			}
+			score++
+		}
+		if p.Variant != "" {
+			if !slices.Contains(variants, p.Variant) {
+				continue
+			}
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = p, score
+		}
+	}
+	return best
+}
+
+// getResourceVariants returns the directory names of all loaded resource paths, e.g. "resource_adb"
+func getResourceVariants() []string {
+	paths := getResourcePaths()
+	variants := make([]string, 0, len(paths))
+	for _, p := range paths {
+		variants = append(variants, filepath.Base(p))
+	}
+	return variants
+}
+
+// getControllerType returns the controller type derived from the loaded resources,
+// since the ADB controller attaches the ADB resource variant and the Win32 controller does not
+func getControllerType(variants []string) string {
+	if slices.Contains(variants, ADB_RESOURCE_VARIANT) {
+		return CONTROLLER_ADB
+	}
+	return CONTROLLER_WIN32
+}
+
+// loadGeometry loads the geometry profiles with their mask images and forgets previous calibrations,
+// called by initResources with the resources locked
+func (i *MapTrackerInfer) loadGeometry(report *ResourceLoadReport) {
+	i.geometryMu.Lock()
+	i.geometries = nil
+	i.geometryMu.Unlock()
+
+	i.masks = make(map[string]*image.Gray)
+	profiles, err := loadGeometryProfiles()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load geometry profiles, using default geometry")
+		i.profiles = nil
+		return
+	}
+	i.profiles = profiles
+
+	for _, p := range profiles {
+		if p.Mask == "" || i.masks[p.Mask] != nil {
+			continue
+		}
+		path := findResource(p.Mask)
+		if path == "" {
+			report.addIssue(LOAD_ISSUE_WARNING, p.Mask, "mask image of profile %q not found, using the circular mask only", p.Name)
+			continue
+		}
+		mask, err := loadMaskImage(path)
+		if err != nil {
+			report.addIssue(LOAD_ISSUE_WARNING, p.Mask, "%v, using the circular mask only", err)
+			continue
+		}
+		i.masks[p.Mask] = mask
+	}
+	log.Info().Int("profilesCount", len(profiles)).Int("masksCount", len(i.masks)).Msg("Geometry profiles loaded")
+}
+
+// getGeometry returns the mini-map geometry for the given tasker, selected by the controller type
+// and the variants of the loaded resources. If the selected profile enables calibration, the screen
+// image is used to calibrate it once per tasker, outside the lock so that other taskers are not blocked.
+// Failed calibrations are retried at increasing intervals, up to CALIBRATION_MAX_FAILURES times.
+func (i *MapTrackerInfer) getGeometry(tasker maa.Tasker, img image.Image) *MinimapGeometry {
+	variants := getResourceVariants()
+	profile := selectGeometryProfile(i.profiles, getControllerType(variants), variants)
+	if profile == nil {
+		return &DEFAULT_GEOMETRY
+	}
+	if profile.Calibration == nil {
+		return &profile.MinimapGeometry
+	}
+
+	i.geometryMu.Lock()
+	failures := 0
+	if g, ok := i.geometries[tasker]; ok && g.profile == profile.Name {
+		if g.calibrated {
+			i.geometryMu.Unlock()
+			return &g.geometry
+		}
+		failures = g.failures
+		retryInterval := CALIBRATION_RETRY_INTERVAL_MS * time.Millisecond << max(failures-1, 0)
+		if g.calibrating || failures >= CALIBRATION_MAX_FAILURES || time.Since(g.time) < retryInterval {
+			i.geometryMu.Unlock()
+			return &profile.MinimapGeometry
+		}
+	}
+	if i.geometries == nil {
+		i.geometries = make(map[maa.Tasker]calibratedGeometry)
+	}
+	i.geometries[tasker] = calibratedGeometry{profile: profile.Name, calibrating: true, failures: failures, time: time.Now()}
+	i.geometryMu.Unlock()
+
+	geometry, score := calibrateGeometry(img, &profile.MinimapGeometry, profile.Calibration)
+
+	i.geometryMu.Lock()
+	defer i.geometryMu.Unlock()
+	if i.geometries == nil {
+		// Resources were reloaded meanwhile, so the outcome is outdated
+		return &profile.MinimapGeometry
+	}
+	if score < profile.Calibration.MinScore {
+		failures++
+		log.Warn().
+			Str("profile", profile.Name).
+			Float64("score", score).
+			Int("failures", failures).
+			Msg("Mini-map calibration not confident, using profile geometry")
+		if failures >= CALIBRATION_MAX_FAILURES {
+			log.Warn().Str("profile", profile.Name).Msg("Mini-map calibration given up")
+		}
+		i.geometries[tasker] = calibratedGeometry{profile: profile.Name, failures: failures, time: time.Now()}
+		return &profile.MinimapGeometry
+	}
+	log.Info().
+		Str("profile", profile.Name).
+		Float64("score", score).
+		Interface("geometry", geometry).
+		Msg("Mini-map geometry calibrated")
+	i.geometries[tasker] = calibratedGeometry{profile: profile.Name, geometry: geometry, calibrated: true, time: time.Now()}
+	return &geometry
+}
+
+// calibratedGeometry is the calibration outcome of a profile
+type calibratedGeometry struct {
+	profile    string
+	geometry   MinimapGeometry
+	calibrated bool
+	// calibrating tells whether a calibration is running
+	calibrating bool
+	// failures is the number of failed calibrations in a row
+	failures int
+	time     time.Time
+}
+
+// calibrateGeometry finds the mini-map border circle around the nominal geometry, by
+// maximizing the consistent brightness step across the circle, and returns the nominal
+// geometry shifted and scaled to it along with the edge score in [0, 1]
+func calibrateGeometry(img image.Image, nominal *MinimapGeometry, cal *GeometryCalibration) (MinimapGeometry, float64) {
+	cx0, cy0 := nominal.Minimap.X, nominal.Minimap.Y
+	rMin := max(int(float64(cal.BorderRadius)*(1-cal.RadiusRange)), CALIBRATION_EDGE_WIDTH+1)
+	rMax := int(math.Ceil(float64(cal.BorderRadius) * (1 + cal.RadiusRange)))
+
+	// Gray scale of the search area
+	pad := cal.Search + rMax + CALIBRATION_EDGE_WIDTH + 1
+	area := image.Rect(cx0-pad, cy0-pad, cx0+pad+1, cy0+pad+1).Intersect(img.Bounds())
+	w, h := area.Dx(), area.Dy()
+	if w == 0 || h == 0 {
+		return *nominal, 0.0
+	}
+	// Gray scale with the weights of color.GrayModel, reading the pixels directly
+	rgba := image.NewRGBA(area)
+	draw.Draw(rgba, area, img, area.Min, draw.Src)
+	gray := make([]int32, w*h)
+	for y := 0; y < h; y++ {
+		row := rgba.Pix[y*rgba.Stride:]
+		for x := 0; x < w; x++ {
+			r, g, b := int32(row[x*4]), int32(row[x*4+1]), int32(row[x*4+2])
+			gray[y*w+x] = (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+		}
+	}
+
+	// Offsets of the inner and outer samples of each radius, relative to the circle center
+	type edgeOffset struct{ inX, inY, outX, outY int }
+	offsets := make([][]edgeOffset, rMax-rMin+1)
+	for r := rMin; r <= rMax; r++ {
+		rIn, rOut := float64(r-CALIBRATION_EDGE_WIDTH), float64(r+CALIBRATION_EDGE_WIDTH)
+		o := make([]edgeOffset, CALIBRATION_ANGLES)
+		for a := range o {
+			theta := 2 * math.Pi * float64(a) / CALIBRATION_ANGLES
+			cos, sin := math.Cos(theta), math.Sin(theta)
+			o[a] = edgeOffset{
+				int(math.Round(rIn * cos)), int(math.Round(rIn * sin)),
+				int(math.Round(rOut * cos)), int(math.Round(rOut * sin)),
+			}
+		}
+		offsets[r-rMin] = o
+	}
+
+	bestScore, bestX, bestY, bestR := 0.0, cx0, cy0, cal.BorderRadius
+	for cy := cy0 - cal.Search; cy <= cy0+cal.Search; cy++ {
+		for cx := cx0 - cal.Search; cx <= cx0+cal.Search; cx++ {
+			px, py := cx-area.Min.X, cy-area.Min.Y
+			for r := rMin; r <= rMax; r++ {
+				var sum int32
+				n := 0
+				for _, o := range offsets[r-rMin] {
+					ix, iy, ox, oy := px+o.inX, py+o.inY, px+o.outX, py+o.outY
+					if ix < 0 || iy < 0 || ix >= w || iy >= h || ox < 0 || oy < 0 || ox >= w || oy >= h {
+						continue
+					}
+					sum += gray[oy*w+ox] - gray[iy*w+ix]
+					n++
+				}
+				// Require most of the circle to be visible
+				if n < CALIBRATION_ANGLES*3/4 {
+					continue
+				}
+				if score := math.Abs(float64(sum)) / float64(n) / 255.0; score > bestScore {
+					bestScore, bestX, bestY, bestR = score, cx, cy, r
+				}
+			}
+		}
+	}
+
+	// Shift and scale the nominal geometry around the mini-map center
+	k := float64(bestR) / float64(cal.BorderRadius)
+	scaleRel := func(v int) int { return int(math.Round(float64(v) * k)) }
+	return MinimapGeometry{
+		Minimap: GeometryCircle{bestX, bestY, scaleRel(nominal.Minimap.Radius)},
+		Pointer: GeometryCircle{
+			bestX + scaleRel(nominal.Pointer.X-cx0),
+			bestY + scaleRel(nominal.Pointer.Y-cy0),
+			scaleRel(nominal.Pointer.Radius),
+		},
+		Scale: nominal.scale() * k,
+		Mask:  nominal.Mask,
+	}, bestScore
+}
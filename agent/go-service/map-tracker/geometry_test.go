@@ -0,0 +1,43 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import "testing"
+
+func TestGetControllerType(t *testing.T) {
+	if c := getControllerType([]string{"resource", "resource_adb"}); c != CONTROLLER_ADB {
+		t.Errorf("controller type with resource_adb is %s, want %s", c, CONTROLLER_ADB)
+	}
+	if c := getControllerType([]string{"resource", "resource_en"}); c != CONTROLLER_WIN32 {
+		t.Errorf("controller type without resource_adb is %s, want %s", c, CONTROLLER_WIN32)
+	}
+}
+
+func TestSelectGeometryProfile(t *testing.T) {
+	profiles := []GeometryProfile{
+		{Name: "default"},
+		{Name: "adb", Controller: CONTROLLER_ADB},
+		{Name: "en", Variant: "resource_en"},
+		{Name: "adb-en", Controller: CONTROLLER_ADB, Variant: "resource_en"},
+		{Name: "default-2"},
+	}
+	cases := []struct {
+		controller string
+		variants   []string
+		want       string
+	}{
+		{CONTROLLER_WIN32, []string{"resource"}, "default"},
+		{CONTROLLER_ADB, []string{"resource", "resource_adb"}, "adb"},
+		{CONTROLLER_WIN32, []string{"resource", "resource_en"}, "en"},
+		{CONTROLLER_ADB, []string{"resource", "resource_adb", "resource_en"}, "adb-en"},
+	}
+	for _, c := range cases {
+		p := selectGeometryProfile(profiles, c.controller, c.variants)
+		if p == nil || p.Name != c.want {
+			t.Errorf("profile for %s %v is %v, want %s", c.controller, c.variants, p, c.want)
+		}
+	}
+
+	if p := selectGeometryProfile(profiles[1:4], CONTROLLER_WIN32, []string{"resource"}); p != nil {
+		t.Errorf("profile %s selected although none matches", p.Name)
+	}
+}
@@ -8,11 +8,14 @@ import (
 	"image"
 	"image/draw"
 	_ "image/png"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/MaaXYZ/MaaEnd/agent/go-service/pkg/maafocus"
@@ -26,10 +29,30 @@ type MapTrackerInferResult struct {
 	X         int     `json:"x"`         // X coordinate on the map
 	Y         int     `json:"y"`         // Y coordinate on the map
 	Rot       int     `json:"rot"`       // Rotation angle (0-359 degrees)
+	RotF      float64 `json:"rotF"`      // Rotation angle with sub-degree precision, in [0, 360)
 	LocConf   float64 `json:"locConf"`   // Location confidence
 	RotConf   float64 `json:"rotConf"`   // Rotation confidence
 	LocTimeMs int64   `json:"locTimeMs"` // Location inference time in ms
 	RotTimeMs int64   `json:"rotTimeMs"` // Rotation inference time in ms
+	Tracked   bool    `json:"tracked"`   // Whether the location was found near the last known location
+	// Relocalized is whether the location was found by feature relocalization without the global search
+	Relocalized bool   `json:"relocalized"`
+	BaseMap     string `json:"baseMap"` // Base map name (same as MapName unless it is a tier map)
+	Tier        string `json:"tier"`    // Tier ID of the map (empty for base maps)
+	BaseX       int    `json:"baseX"`   // X coordinate on the base map
+	BaseY       int    `json:"baseY"`   // Y coordinate on the base map
+	// Candidates are the best distinct locations across maps, best first (the first one is the result itself)
+	Candidates []MapTrackerCandidate `json:"candidates"`
+	// Margin is the confidence of the best candidate minus that of the second best
+	Margin float64 `json:"margin"`
+}
+
+// MapTrackerCandidate represents a candidate location of map tracking inference
+type MapTrackerCandidate struct {
+	MapName string  `json:"mapName"` // Map name
+	X       int     `json:"x"`       // X coordinate on the map
+	Y       int     `json:"y"`       // Y coordinate on the map
+	Conf    float64 `json:"conf"`    // Location confidence
 }
 
 // MapTrackerInferParam represents the custom_recognition_param for MapTrackerInfer
@@ -40,6 +63,18 @@ type MapTrackerInferParam struct {
 	Precision float64 `json:"precision,omitempty"`
 	// Threshold controls the minimum confidence required to consider the inference successful.
 	Threshold float64 `json:"threshold,omitempty"`
+	// Track enables tracking mode, which searches around the last known location first.
+	Track bool `json:"track,omitempty"`
+	// MinMargin is the minimum confidence margin between the best and the second best candidates.
+	MinMargin float64 `json:"min_margin,omitempty"`
+	// NoRelocalize disables feature relocalization in tracking mode when there is no tracked location.
+	NoRelocalize bool `json:"no_relocalize,omitempty"`
+	// Backend is the template matching backend, one of "auto" (default), "direct" and "fft".
+	Backend string `json:"backend,omitempty"`
+	// NoMask disables the mini-map mask and matches the whole square crop of the mini-map.
+	NoMask bool `json:"no_mask,omitempty"`
+	// Debug enables writing an annotated debug image of each inference to the debug directory.
+	Debug bool `json:"debug,omitempty"`
 	// Whether to print status to GUI.
 	Print bool `json:"print,omitempty"`
 }
@@ -51,22 +86,50 @@ type MapCache struct {
 	Integral *IntegralImage
 	OffsetX  int
 	OffsetY  int
+	// Levels is the image pyramid of the map, aligned with PYRAMID_SCALES
+	Levels []MapLevel
+	// Features are the keypoints and descriptors of Img for relocalization
+	Features mapFeatures
+	// BaseName is the base map name, which is the map itself unless it is a tier map
+	BaseName string
+	// Tier is the tier ID of a tier map, or empty for base maps
+	Tier string
+	// BaseOffsetX and BaseOffsetY convert map coordinates to base map coordinates
+	BaseOffsetX int
+	BaseOffsetY int
 }
 
 // MapTrackerInfer is the custom recognition component for map tracking
 type MapTrackerInfer struct {
-	// Cache for preloaded resources
-	mapsOnce    sync.Once
-	pointerOnce sync.Once
-	maps        []MapCache
-	pointer     *image.RGBA
-	mapsErr     error
-	pointerErr  error
-
-	// Cache for scaled maps
-	scaledMu    sync.Mutex
-	scaledScale float64
-	scaledMaps  []MapCache
+	// Cache for preloaded resources, reloaded when the resource generation changes.
+	// resMu is held for reading while the resources are in use.
+	resMu      sync.RWMutex
+	resGen     atomic.Uint64
+	resReport  atomic.Pointer[ResourceLoadReport]
+	maps       []MapCache
+	pointer    *image.RGBA
+	pointerPol *polarImage
+	mapsErr    error
+	pointerErr error
+	// masks are the mini-map mask images of the geometry profiles, keyed by resource path
+	masks map[string]*image.Gray
+	// mapping backs the maps loaded from the map cache, or nil if decoded
+	mapping *mappedFile
+
+	// Last known locations for tracking mode, keyed by tasker
+	trackMu sync.Mutex
+	tracks  map[maa.Tasker]trackState
+
+	// Mini-map geometry profiles, and calibrated geometries keyed by tasker
+	profiles   []GeometryProfile
+	geometryMu sync.Mutex
+	geometries map[maa.Tasker]calibratedGeometry
+}
+
+// trackState is the last known location of the player in tracking mode
+type trackState struct {
+	MapName string
+	X, Y    int
 }
 
 //go:embed messages/inference_failed.html
@@ -93,19 +156,10 @@ func (i *MapTrackerInfer) Run(ctx *maa.Context, arg *maa.CustomRecognitionArg) (
 		return nil, false
 	}
 
-	locScale := param.Precision
-	var rotStep int
-	if param.Precision < 0.3 {
-		rotStep = 12
-	} else if param.Precision < 0.6 {
-		rotStep = 6
-	} else {
-		rotStep = 3
-	}
-
-	// Initialize resources on first run
-	i.initMaps(ctx)
-	i.initPointer(ctx)
+	// Initialize resources on first run, or reload them if changed
+	i.initResources(ctx)
+	i.resMu.RLock()
+	defer i.resMu.RUnlock()
 
 	// Check for initialization errors
 	if i.mapsErr != nil {
@@ -117,32 +171,39 @@ func (i *MapTrackerInfer) Run(ctx *maa.Context, arg *maa.CustomRecognitionArg) (
 		return nil, false
 	}
 
-	// Perform location inference
-	t0 := time.Now()
-	locX, locY, locConf, mapName := i.inferLocation(arg.Img, locScale, mapNameRegex)
-	locTime := time.Since(t0)
-
-	// Perform rotation inference (if pointer is loaded)
-	rot, rotConf := 0, 0.0
-	var rotTime time.Duration
-	t1 := time.Now()
-	rot, rotConf = i.inferRotation(arg.Img, rotStep)
-	rotTime = time.Since(t1)
+	// Look up the last known location in tracking mode
+	var last *trackState
+	tasker := *ctx.GetTasker()
+	if param.Track {
+		last = i.getTrack(tasker)
+	}
 
-	// Build result
-	result := MapTrackerInferResult{
-		MapName:   mapName,
-		X:         locX,
-		Y:         locY,
-		Rot:       rot,
-		LocConf:   locConf,
-		RotConf:   rotConf,
-		LocTimeMs: locTime.Milliseconds(),
-		RotTimeMs: rotTime.Milliseconds(),
+	// Perform inference
+	geometry := i.getGeometry(tasker, arg.Img)
+	var dbg *inferDebug
+	if param.Debug {
+		dbg = &inferDebug{}
+	}
+	result := i.infer(arg.Img, geometry, param, mapNameRegex, last, dbg)
+	if dbg != nil {
+		if path, err := i.writeInferDebug(dbg, result); err != nil {
+			log.Warn().Err(err).Msg("Failed to write inference debug image")
+		} else {
+			log.Info().Str("path", path).Msg("Inference debug image written")
+		}
 	}
 
 	// Determine if recognition hit
-	hit := locConf > param.Threshold && rotConf > param.Threshold
+	hit := result.LocConf > param.Threshold && result.RotConf > param.Threshold && result.Margin >= param.MinMargin
+
+	// Update the last known location in tracking mode
+	if param.Track {
+		if hit {
+			i.setTrack(tasker, &trackState{result.MapName, result.X, result.Y})
+		} else {
+			i.setTrack(tasker, nil)
+		}
+	}
 
 	// Serialize result to JSON
 	detailJSON, err := json.Marshal(result)
@@ -152,22 +213,24 @@ func (i *MapTrackerInfer) Run(ctx *maa.Context, arg *maa.CustomRecognitionArg) (
 	}
 
 	log.Info().
-		Str("mapName", mapName).
-		Int("x", locX).
-		Int("y", locY).
-		Int("rot", rot).
-		Dur("locTime", locTime).
-		Dur("rotTime", rotTime).
-		Float64("locConf", locConf).
-		Float64("rotConf", rotConf).
+		Str("mapName", result.MapName).
+		Int("x", result.X).
+		Int("y", result.Y).
+		Int("rot", result.Rot).
+		Int64("locTimeMs", result.LocTimeMs).
+		Int64("rotTimeMs", result.RotTimeMs).
+		Float64("locConf", result.LocConf).
+		Float64("rotConf", result.RotConf).
+		Float64("margin", result.Margin).
+		Bool("tracked", result.Tracked).
 		Bool("hit", hit).
 		Msg("Map tracking inference completed")
 
 	if param.Print {
 		if hit {
-			maafocus.NodeActionStarting(ctx, fmt.Sprintf(inferenceFinishedHTML, locX, locY, rot, mapName))
+			maafocus.NodeActionStarting(ctx, fmt.Sprintf(inferenceFinishedHTML, result.X, result.Y, result.Rot, result.MapName))
 		} else {
-			maafocus.NodeActionStarting(ctx, fmt.Sprintf(inferenceFailedHTML, locConf, rotConf))
+			maafocus.NodeActionStarting(ctx, fmt.Sprintf(inferenceFailedHTML, result.LocConf, result.RotConf))
 		}
 	}
 
@@ -196,6 +259,18 @@ func (r *MapTrackerInfer) parseParam(paramStr string) (*MapTrackerInferParam, er
 			} else if param.Threshold < 0.0 || param.Threshold > 1.0 {
 				return nil, fmt.Errorf("invalid threshold value: %f", param.Threshold)
 			}
+
+			if param.MinMargin < 0.0 || param.MinMargin > 1.0 {
+				return nil, fmt.Errorf("invalid min_margin value: %f", param.MinMargin)
+			}
+
+			switch param.Backend {
+			case "":
+				param.Backend = DEFAULT_INFERENCE_PARAM.Backend
+			case MATCH_BACKEND_AUTO, MATCH_BACKEND_DIRECT, MATCH_BACKEND_FFT:
+			default:
+				return nil, fmt.Errorf("invalid backend value: %s", param.Backend)
+			}
 		} else {
 			return nil, fmt.Errorf("failed to unmarshal parameters: %w", err)
 		}
@@ -205,46 +280,236 @@ func (r *MapTrackerInfer) parseParam(paramStr string) (*MapTrackerInferParam, er
 	}
 }
 
-// initMaps initializes the map cache (thread-safe, runs once)
-func (i *MapTrackerInfer) initMaps(ctx *maa.Context) {
-	i.mapsOnce.Do(func() {
-		i.maps, i.mapsErr = i.loadMaps(ctx)
-		if i.mapsErr != nil {
-			log.Error().Err(i.mapsErr).Msg("Failed to load maps")
-		} else {
-			log.Info().Int("mapsCount", len(i.maps)).Msg("Map images loaded")
+// infer runs location and rotation inference on a 1280x720 screen image.
+// If last is not nil, the area around it is searched first, and the global search
+// is only performed when the confidence there is below the tracking threshold.
+// If dbg is not nil, the intermediate results are collected into it.
+// Resources must have been initialized before calling this.
+func (i *MapTrackerInfer) infer(img image.Image, geometry *MinimapGeometry, param *MapTrackerInferParam, mapNameRegex *regexp.Regexp, last *trackState, dbg *inferDebug) *MapTrackerInferResult {
+	miniMap := geometry.cropMinimap(img)
+	if dbg != nil {
+		dbg.MiniMap = miniMap
+	}
+	var mask *image.Gray
+	if !param.NoMask {
+		mask = buildMinimapMask(geometry, i.masks[geometry.Mask])
+	}
+
+	// Perform location inference
+	t0 := time.Now()
+	tracked, relocalized := false, false
+	var candidates []MapTrackerCandidate
+	if last != nil && mapNameRegex.MatchString(last.MapName) {
+		candidates = i.inferLocationNear(miniMap, mask, param, last, mapNameRegex)
+		tracked = len(candidates) > 0 && candidates[0].Conf > max(param.Threshold, TRACK_THRESHOLD)
+		if !tracked {
+			log.Debug().Str("map", last.MapName).Msg("Tracking lost, falling back to global search")
 		}
-	})
-}
+	}
+	if !tracked && param.Track && !param.NoRelocalize {
+		candidates = i.inferLocationByFeatures(miniMap, mask, param, mapNameRegex)
+		relocalized = len(candidates) > 0 && candidates[0].Conf > max(param.Threshold, TRACK_THRESHOLD)
+		if relocalized && len(candidates) == 1 {
+			// Search around the relocalized location for runner-ups of the margin
+			best := candidates[0]
+			near := i.inferLocationNear(miniMap, mask, param, &trackState{best.MapName, best.X, best.Y}, mapNameRegex)
+			candidates = i.mergeCandidates(candidates, near)
+		}
+		if !relocalized {
+			log.Debug().Int("candidates", len(candidates)).Msg("Relocalization failed, falling back to global search")
+		}
+	}
+	if !tracked && !relocalized {
+		candidates = i.mergeCandidates(i.inferLocation(miniMap, mask, param, mapNameRegex), candidates)
+	}
+	locTime := time.Since(t0)
 
-// initPointer initializes the pointer template cache (thread-safe, runs once)
-func (i *MapTrackerInfer) initPointer(ctx *maa.Context) {
-	i.pointerOnce.Do(func() {
-		i.pointer, i.pointerErr = i.loadPointer(ctx)
-		if i.pointerErr != nil {
-			log.Error().Err(i.pointerErr).Msg("Failed to load pointer template")
-		} else {
-			log.Info().Msg("Pointer template image loaded")
+	locX, locY, locConf, mapName, margin := 0, 0, 0.0, "None", 0.0
+	if len(candidates) > 0 {
+		best := candidates[0]
+		locX, locY, locConf, mapName = best.X, best.Y, best.Conf, best.MapName
+		margin = best.Conf
+		if len(candidates) > 1 {
+			margin -= candidates[1].Conf
 		}
-	})
+	}
+
+	// Perform rotation inference
+	t1 := time.Now()
+	rotF, rotConf := i.inferRotation(geometry.cropPointer(img), dbg)
+	rotTime := time.Since(t1)
+
+	result := &MapTrackerInferResult{
+		MapName:     mapName,
+		X:           locX,
+		Y:           locY,
+		Rot:         int(math.Round(rotF)) % 360,
+		RotF:        rotF,
+		LocConf:     locConf,
+		RotConf:     rotConf,
+		LocTimeMs:   locTime.Milliseconds(),
+		RotTimeMs:   rotTime.Milliseconds(),
+		Tracked:     tracked,
+		Relocalized: relocalized,
+		BaseMap:     mapName,
+		BaseX:       locX,
+		BaseY:       locY,
+		Candidates:  candidates,
+		Margin:      margin,
+	}
+	if m := i.findMap(mapName); m != nil {
+		result.BaseMap, result.Tier = m.BaseName, m.Tier
+		result.BaseX, result.BaseY = locX+m.BaseOffsetX, locY+m.BaseOffsetY
+	}
+	return result
+}
+
+// parseInferDetail extracts the MapTrackerInferResult from the detail JSON
+// of a recognition run through ctx.RunRecognition
+func parseInferDetail(detailJson string) (*MapTrackerInferResult, error) {
+	var wrapped struct {
+		Best struct {
+			Detail json.RawMessage `json:"detail"`
+		} `json:"best"`
+	}
+	if err := json.Unmarshal([]byte(detailJson), &wrapped); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal wrapped result: %w", err)
+	}
+	var result MapTrackerInferResult
+	if err := json.Unmarshal(wrapped.Best.Detail, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal MapTrackerInferResult: %w", err)
+	}
+	return &result, nil
+}
+
+// getTrack returns the last known location of the given tasker, or nil if unknown
+func (i *MapTrackerInfer) getTrack(tasker maa.Tasker) *trackState {
+	i.trackMu.Lock()
+	defer i.trackMu.Unlock()
+	if t, ok := i.tracks[tasker]; ok {
+		return &t
+	}
+	return nil
 }
 
-// loadMaps loads all map images from the resource directory
-// and try crops them if map_rect.json exists
-func (i *MapTrackerInfer) loadMaps(ctx *maa.Context) ([]MapCache, error) {
+// setTrack updates the last known location of the given tasker, or clears it if state is nil
+func (i *MapTrackerInfer) setTrack(tasker maa.Tasker, state *trackState) {
+	i.trackMu.Lock()
+	defer i.trackMu.Unlock()
+	if state == nil {
+		delete(i.tracks, tasker)
+		return
+	}
+	if i.tracks == nil {
+		i.tracks = make(map[maa.Tasker]trackState)
+	}
+	i.tracks[tasker] = *state
+}
+
+// initResources loads the maps, the pointer template and the geometry profiles on first run,
+// and reloads them whenever resources have been loaded again since (thread-safe).
+// Reloading waits for the current users of the resources, who hold resMu for reading.
+func (i *MapTrackerInfer) initResources(ctx *maa.Context) {
+	gen := getResourceGeneration()
+	if i.resReport.Load() != nil && i.resGen.Load() == gen {
+		return
+	}
+
+	i.resMu.Lock()
+	defer i.resMu.Unlock()
+	if i.resReport.Load() != nil && i.resGen.Load() == gen {
+		return
+	}
+	if i.resReport.Load() != nil {
+		log.Info().Uint64("generation", gen).Msg("Resources reloaded, reloading map-tracker resources")
+	}
+
+	report := &ResourceLoadReport{Generation: gen}
+	i.maps, i.mapsErr = i.loadMaps(ctx, report)
+	if i.mapsErr != nil {
+		log.Error().Err(i.mapsErr).Msg("Failed to load maps")
+	}
+	i.pointer, i.pointerErr = i.loadPointer(ctx, report)
+	if i.pointerErr != nil {
+		log.Error().Err(i.pointerErr).Msg("Failed to load pointer template")
+	} else {
+		b := i.pointer.Rect
+		i.pointerPol = unwrapPolar(i.pointer, float64(b.Dx())/2, float64(b.Dy())/2)
+	}
+	i.loadGeometry(report)
+	report.log()
+
+	// Locations and calibrations refer to the previous resources
+	i.trackMu.Lock()
+	i.tracks = nil
+	i.trackMu.Unlock()
+
+	i.resGen.Store(gen)
+	i.resReport.Store(report)
+}
+
+// getLoadReport returns the report of the last resource load, or nil if not loaded yet
+func (i *MapTrackerInfer) getLoadReport() *ResourceLoadReport {
+	return i.resReport.Load()
+}
+
+// loadMaps loads the preprocessed maps from the on-disk cache if it matches the map directory,
+// otherwise decodes them from the resource directory and writes the cache for the next start.
+// The previous cache mapping is released once the new maps are in place.
+func (i *MapTrackerInfer) loadMaps(ctx *maa.Context, report *ResourceLoadReport) ([]MapCache, error) {
 	// Find map directory using search strategy
 	mapDir := findResource(MAP_DIR)
 	if mapDir == "" {
 		return nil, fmt.Errorf("map directory not found (searched in cache and standard locations)")
 	}
+	report.MapDir = mapDir
+
+	prevMapping := i.mapping
+	defer func() {
+		if prevMapping != nil && prevMapping != i.mapping {
+			prevMapping.Close()
+		}
+	}()
+	i.mapping = nil
+
+	hash, err := hashMapDir(mapDir)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to hash map directory, map cache disabled")
+		return decodeMaps(mapDir, report)
+	}
+	if maps, mapping, err := openMapCache(hash, report); err == nil {
+		i.mapping = mapping
+		log.Info().Str("path", getMapCachePath(hash)).Int("mapsCount", len(maps)).Msg("Maps loaded from cache")
+		return maps, nil
+	} else if !os.IsNotExist(err) {
+		log.Warn().Err(err).Msg("Invalid map cache, rebuilding")
+	}
+
+	maps, err := decodeMaps(mapDir, report)
+	if err != nil {
+		return nil, err
+	}
+	if path, err := writeMapCache(hash, maps, report); err != nil {
+		log.Warn().Err(err).Msg("Failed to write map cache")
+	} else {
+		log.Info().Str("path", path).Msg("Map cache written")
+	}
+	return maps, nil
+}
 
+// decodeMaps loads all map images from the map directory
+// and try crops them if map_rect.json exists.
+// Problems with individual maps are recorded into the report instead of failing the load.
+func decodeMaps(mapDir string, report *ResourceLoadReport) ([]MapCache, error) {
 	// Read map_rect.json if it exists
 	rectList := make(map[string][]int)
 	rectPath := filepath.Join(mapDir, "map_rect.json")
+	hasRectList := false
 	if data, err := os.ReadFile(rectPath); err == nil {
 		if err := json.Unmarshal(data, &rectList); err != nil {
-			log.Warn().Err(err).Str("path", rectPath).Msg("Failed to unmarshal map_rect.json")
+			report.addIssue(LOAD_ISSUE_ERROR, "map_rect.json", "failed to unmarshal: %v", err)
 		} else {
+			hasRectList = true
 			log.Info().Msg("Map rect JSON loaded")
 		}
 	}
@@ -257,6 +522,8 @@ func (i *MapTrackerInfer) loadMaps(ctx *maa.Context) ([]MapCache, error) {
 
 	// Load all PNG files
 	maps := make([]MapCache, 0)
+	heights := make(map[string]int)
+	minSize := DEFAULT_GEOMETRY.Minimap.Radius * 2
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
@@ -267,42 +534,56 @@ func (i *MapTrackerInfer) loadMaps(ctx *maa.Context) ([]MapCache, error) {
 			continue
 		}
 
+		// Extract map name (remove ".png" suffix)
+		name := strings.TrimSuffix(filename, ".png")
+
 		// Load image
 		imgPath := filepath.Join(mapDir, filename)
 		file, err := os.Open(imgPath)
 		if err != nil {
-			log.Warn().Err(err).Str("path", imgPath).Msg("Failed to open map image")
+			report.addIssue(LOAD_ISSUE_ERROR, name, "failed to open map image: %v", err)
 			continue
 		}
 
 		img, _, err := image.Decode(file)
 		file.Close()
 		if err != nil {
-			log.Warn().Err(err).Str("path", imgPath).Msg("Failed to decode map image")
+			report.addIssue(LOAD_ISSUE_ERROR, name, "failed to decode map image: %v", err)
 			continue
 		}
-
-		// Extract map name (remove ".png" suffix)
-		name := strings.TrimSuffix(filename, ".png")
+		b := img.Bounds()
+		heights[name] = b.Dy()
 
 		var imgRGBA *image.RGBA
 		offsetX, offsetY := 0, 0
+		loadEntry := MapLoadEntry{Name: name, Width: b.Dx(), Height: b.Dy()}
 
 		// Crop if valid rect exists
-		if r, ok := rectList[name]; ok && len(r) == 4 {
-			rect := image.Rect(r[0], r[1], r[2], r[3])
-			// Crop precisely using drawing
-			b := img.Bounds()
-			r0 := rect.Intersect(b)
-			dst := image.NewRGBA(image.Rect(0, 0, r0.Dx(), r0.Dy()))
-			draw.Draw(dst, dst.Bounds(), img, r0.Min, draw.Src)
-			imgRGBA = dst
-			offsetX, offsetY = r0.Min.X, r0.Min.Y
-		} else {
+		r, hasRect := rectList[name]
+		if hasRect {
+			if rect, ok := validateMapRect(report, name, r, b.Dx(), b.Dy()); ok {
+				// Crop precisely using drawing
+				r0 := image.Rect(rect[0], rect[1], rect[2], rect[3]).Add(b.Min)
+				dst := image.NewRGBA(image.Rect(0, 0, r0.Dx(), r0.Dy()))
+				draw.Draw(dst, dst.Bounds(), img, r0.Min, draw.Src)
+				imgRGBA = dst
+				offsetX, offsetY = rect[0], rect[1]
+				loadEntry.Rect = &rect
+			}
+		} else if hasRectList {
+			report.addIssue(LOAD_ISSUE_WARNING, name, "no entry in map_rect.json, using the whole image")
+		}
+		if imgRGBA == nil {
 			imgRGBA = ToRGBA(img)
 		}
 
-		// Precompute integral image
+		// The mini-map must fit in the map to be matched
+		if imgRGBA.Rect.Dx() < minSize || imgRGBA.Rect.Dy() < minSize {
+			report.addIssue(LOAD_ISSUE_ERROR, name, "map size %dx%d is smaller than the mini-map size %d", imgRGBA.Rect.Dx(), imgRGBA.Rect.Dy(), minSize)
+			continue
+		}
+
+		// Precompute integral image, pyramid and features
 		integral := NewIntegralImage(imgRGBA)
 
 		maps = append(maps, MapCache{
@@ -311,23 +592,45 @@ func (i *MapTrackerInfer) loadMaps(ctx *maa.Context) ([]MapCache, error) {
 			Integral: integral,
 			OffsetX:  offsetX,
 			OffsetY:  offsetY,
+			Levels:   buildPyramid(imgRGBA, integral),
+			Features: extractFeatures(imgRGBA, nil),
 		})
+		report.Maps = append(report.Maps, loadEntry)
+	}
+
+	// Entries of map_rect.json without a map image
+	orphans := make([]string, 0)
+	for name := range rectList {
+		if _, ok := heights[name]; !ok {
+			orphans = append(orphans, name)
+		}
+	}
+	slices.Sort(orphans)
+	for _, name := range orphans {
+		report.addIssue(LOAD_ISSUE_WARNING, name, "orphaned entry in map_rect.json without a map image")
 	}
 
 	if len(maps) == 0 {
 		return nil, fmt.Errorf("no valid map images found in %s", mapDir)
 	}
 
+	// Link tier maps to their base maps
+	resolveTiers(maps, heights)
+	for idx := range maps {
+		report.Maps[idx].Tier = maps[idx].Tier
+	}
+
 	return maps, nil
 }
 
 // loadPointer loads the pointer template image
-func (i *MapTrackerInfer) loadPointer(ctx *maa.Context) (*image.RGBA, error) {
+func (i *MapTrackerInfer) loadPointer(ctx *maa.Context, report *ResourceLoadReport) (*image.RGBA, error) {
 	// Find pointer template using search strategy
 	pointerPath := findResource(POINTER_PATH)
 	if pointerPath == "" {
 		return nil, fmt.Errorf("pointer template not found (searched in cache and standard locations)")
 	}
+	report.PointerPath = pointerPath
 
 	// Load image
 	file, err := os.Open(pointerPath)
@@ -342,142 +645,257 @@ func (i *MapTrackerInfer) loadPointer(ctx *maa.Context) (*image.RGBA, error) {
 	}
 
 	rgba := ToRGBA(img)
+
+	// The polar unwrap must fit in the template
+	if minSize := int(math.Ceil(ROT_POLAR_MAX_RADIUS * 2)); rgba.Rect.Dx() < minSize || rgba.Rect.Dy() < minSize {
+		report.addIssue(LOAD_ISSUE_WARNING, POINTER_PATH, "pointer template size %dx%d is smaller than %d, rotation may be inaccurate", rgba.Rect.Dx(), rgba.Rect.Dy(), minSize)
+	}
 	return rgba, nil
 }
 
-// inferLocation infers the player's location on the map
-// Returns (x, y, confidence, mapName)
-func (i *MapTrackerInfer) inferLocation(screenImg image.Image, locScale float64, mapNameRegex *regexp.Regexp) (int, int, float64, string) {
-	// Use cached scaled maps
-	scaledMaps := i.getScaledMaps(locScale)
-	if len(scaledMaps) == 0 {
+// inferLocation infers the player's location on the map from the cropped mini-map,
+// using a coarse-to-fine search over the map pyramids
+// Returns up to INFER_TOP_K distinct candidates, best first, or nil if nothing can be matched
+func (i *MapTrackerInfer) inferLocation(miniMap image.Image, mask *image.Gray, param *MapTrackerInferParam, mapNameRegex *regexp.Regexp) []MapTrackerCandidate {
+	if len(i.maps) == 0 {
 		log.Warn().Msg("No maps available for matching")
-		return 0, 0, 0.0, "None"
+		return nil
 	}
 
-	// Crop mini-map area from screen
-	miniMap := cropArea(screenImg, LOC_CENTER_X, LOC_CENTER_Y, LOC_RADIUS)
-
-	// Scale mini-map
-	if locScale != 1.0 {
-		miniMap = scaleImage(miniMap, locScale)
+	// Build needles of the mini-map for each pyramid level
+	target := pyramidLevel(param.Precision)
+	needles := newPyramidNeedles(miniMap, mask, target)
+	if needles[0].Stats.Dn < 1e-6 {
+		return nil
 	}
 
-	miniMapRGBA := ToRGBA(miniMap)
-
-	miniMapBounds := miniMap.Bounds()
-	miniMapW, miniMapH := miniMapBounds.Dx(), miniMapBounds.Dy()
-
-	// Precompute needle (minimap) statistics for all matches
-	miniStats := GetNeedleStats(miniMapRGBA)
-	if miniStats.Dn < 1e-6 {
-		return 0, 0, 0.0, "None"
-	}
-
-	// Match against all maps
-	bestVal := -1.0
-	bestX, bestY := 0, 0
-	bestMapName := "None"
-
+	// Coarse search over all maps matching the regex, keeping a few distinct peaks per map
+	candidates := make([]pyramidCandidate, 0)
 	triedCount := 0
-
-	for _, mapData := range scaledMaps {
-		// Filter maps based on regex
+	nmsDist := max(needles[0].W, needles[0].H) / 2
+	opts := NewMatchOptions(needles[0].W, needles[0].H, param.Precision, param.Backend)
+	for idx := range i.maps {
+		mapData := &i.maps[idx]
 		if !mapNameRegex.MatchString(mapData.Name) {
 			continue
 		}
 		triedCount++
-
-		// Perform template matching (using optimized version with precomputed stats)
-		// Note: mapData.Img is already cropped if a rect was provided in map_rect.json
-		matchX, matchY, matchVal := MatchTemplateOptimized(mapData.Img, mapData.Integral, miniMapRGBA, miniStats)
-
-		if matchVal > bestVal {
-			bestVal = matchVal
-			// Convert top-left corner to center position
-			// Then convert back to original scale and add map offset
-			bestX = int(float64(matchX+miniMapW/2)/locScale) + mapData.OffsetX
-			bestY = int(float64(matchY+miniMapH/2)/locScale) + mapData.OffsetY
-			bestMapName = mapData.Name
+		level := &mapData.Levels[0]
+		region := image.Rect(0, 0, level.Img.Rect.Dx(), level.Img.Rect.Dy())
+		for _, p := range MatchTemplateTopK(level.Img, level.Integral, needles[0].Img, needles[0].Stats, region, PYRAMID_PEAKS_PER_MAP, nmsDist, opts) {
+			candidates = append(candidates, pyramidCandidate{mapData, p.X, p.Y, p.Score})
 		}
 	}
 
 	if triedCount == 0 {
 		log.Warn().Str("regex", mapNameRegex.String()).Msg("No maps matched the regex")
+		return nil
 	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Refine the best candidates on finer levels
+	candidates = refinePyramidCandidates(candidates, needles, target, param.Precision, param.Backend)
+	result := i.suppressCandidates(candidates, needles[target])
 
 	log.Debug().Int("triedMaps", triedCount).
-		Float64("bestVal", bestVal).
-		Str("bestMap", bestMapName).
+		Int("level", target).
+		Float64("bestVal", result[0].Conf).
+		Str("bestMap", result[0].MapName).
+		Int("candidates", len(result)).
 		Msg("Location inference completed")
 
-	return bestX, bestY, bestVal, bestMapName
+	return result
 }
 
-// getScaledMaps returns cached scaled maps or recomputes them
-func (i *MapTrackerInfer) getScaledMaps(scale float64) []MapCache {
-	i.scaledMu.Lock()
-	defer i.scaledMu.Unlock()
-
-	if i.scaledScale == scale && len(i.scaledMaps) > 0 {
-		return i.scaledMaps
-	}
-
-	log.Info().Float64("scale", scale).Msg("Recomputing scaled maps cache")
-	newScaled := make([]MapCache, 0, len(i.maps))
-	for _, m := range i.maps {
-		sImg := scaleImage(m.Img, scale)
-		sRGBA := ToRGBA(sImg)
-		newScaled = append(newScaled, MapCache{
-			Name:     m.Name,
-			Img:      sRGBA,
-			Integral: NewIntegralImage(sRGBA),
-			OffsetX:  m.OffsetX,
-			OffsetY:  m.OffsetY,
-		})
+// suppressCandidates converts the refined candidates (sorted best first) to map coordinates,
+// dropping those within INFER_NMS_RADIUS of a better one at the same place of the base map
+// (including the same place on sibling tier layers), and keeping up to INFER_TOP_K of them
+func (i *MapTrackerInfer) suppressCandidates(candidates []pyramidCandidate, needle *pyramidNeedle) []MapTrackerCandidate {
+	type kept struct {
+		baseName     string
+		baseX, baseY int
+	}
+	result := make([]MapTrackerCandidate, 0, INFER_TOP_K)
+	keptList := make([]kept, 0, INFER_TOP_K)
+	for _, c := range candidates {
+		x, y := c.mapPosition(needle)
+		k := kept{c.Map.BaseName, x + c.Map.BaseOffsetX, y + c.Map.BaseOffsetY}
+		suppressed := false
+		for _, o := range keptList {
+			if o.baseName == k.baseName && math.Hypot(float64(o.baseX-k.baseX), float64(o.baseY-k.baseY)) <= INFER_NMS_RADIUS {
+				suppressed = true
+				break
+			}
+		}
+		if suppressed {
+			continue
+		}
+		keptList = append(keptList, k)
+		result = append(result, MapTrackerCandidate{c.Map.Name, x, y, c.Score})
+		if len(result) == INFER_TOP_K {
+			break
+		}
 	}
-	i.scaledScale = scale
-	i.scaledMaps = newScaled
-	return i.scaledMaps
+	return result
 }
 
-// inferRotation infers the player's rotation angle
-// Returns (angle, confidence)
-func (i *MapTrackerInfer) inferRotation(screenImg image.Image, rotStep int) (int, float64) {
-	if i.pointer == nil {
-		return 0, 0.0
+// inferLocationByFeatures infers the player's location by matching the features of the mini-map
+// against those of all maps matching the regex, then refines the most voted translations
+// by template matching on the target pyramid level.
+// It does not rely on the last location and tolerates partial occlusion of the mini-map,
+// so it is used to recover from lost tracking before falling back to the global search.
+// Returns up to INFER_TOP_K distinct candidates, best first, or nil if nothing can be matched
+func (i *MapTrackerInfer) inferLocationByFeatures(miniMap image.Image, mask *image.Gray, param *MapTrackerInferParam, mapNameRegex *regexp.Regexp) []MapTrackerCandidate {
+	maps := make([]*MapCache, 0, len(i.maps))
+	for idx := range i.maps {
+		if mapNameRegex.MatchString(i.maps[idx].Name) {
+			maps = append(maps, &i.maps[idx])
+		}
+	}
+	if len(maps) == 0 {
+		return nil
 	}
 
-	// Crop pointer area from screen
-	patch := cropArea(screenImg, ROT_CENTER_X, ROT_CENTER_Y, ROT_RADIUS)
-	patchRGBA := ToRGBA(patch)
+	// Vote for translations of the mini-map at the original scale
+	miniRGBA := ToRGBA(miniMap)
+	query := extractMinimapFeatures(miniRGBA, mask)
+	votes := voteFeatureTranslations(query, maps)
+	if len(votes) == 0 {
+		log.Debug().Int("features", len(query.Points)).Msg("No translation voted by features")
+		return nil
+	}
 
-	// Precompute needle (pointer) statistics
-	pointerStats := GetNeedleStats(i.pointer)
-	if pointerStats.Dn < 1e-6 {
-		return 0, 0.0
+	target := pyramidLevel(param.Precision)
+	needle := newPyramidNeedle(miniMap, mask, PYRAMID_SCALES[target])
+	if needle.Stats.Dn < 1e-6 {
+		return nil
 	}
+	candidates := make([]pyramidCandidate, 0, len(votes))
+	r := int(math.Ceil(FEATURE_VOTE_BIN*1.5*needle.Scale)) + 1
+	opts := NewMatchOptions(needle.W, needle.H, param.Precision, param.Backend)
+	for _, v := range votes {
+		level := &v.Map.Levels[target]
+		cx, cy := int(float64(v.X)*needle.Scale), int(float64(v.Y)*needle.Scale)
+		region := image.Rect(cx-r, cy-r, cx+r+1, cy+r+1)
+		matchX, matchY, matchVal := MatchTemplateInRegion(level.Img, level.Integral, needle.Img, needle.Stats, region, opts)
+		candidates = append(candidates, pyramidCandidate{v.Map, matchX, matchY, matchVal})
+	}
+	sortPyramidCandidates(candidates)
+	result := i.suppressCandidates(candidates, needle)
 
-	// Try all rotation angles
-	bestAngle := 0
-	maxVal := -1.0
+	log.Debug().Int("features", len(query.Points)).
+		Int("votes", votes[0].Votes).
+		Float64("bestVal", result[0].Conf).
+		Str("bestMap", result[0].MapName).
+		Msg("Feature relocalization completed")
 
-	for angle := 0; angle < 360; angle += rotStep {
-		// Rotate the patch
-		rotatedRGBA := rotateImageRGBA(patchRGBA, float64(angle))
+	return result
+}
 
-		// Match against pointer template
-		integral := NewIntegralImage(rotatedRGBA)
-		_, _, matchVal := MatchTemplateOptimized(rotatedRGBA, integral, i.pointer, pointerStats)
+// mergeCandidates merges two candidate lists sorted best first, dropping the ones within
+// INFER_NMS_RADIUS of a better one on the same base map, and keeping up to INFER_TOP_K of them
+func (i *MapTrackerInfer) mergeCandidates(a, b []MapTrackerCandidate) []MapTrackerCandidate {
+	all := append(slices.Clone(a), b...)
+	slices.SortStableFunc(all, func(x, y MapTrackerCandidate) int {
+		if x.Conf > y.Conf {
+			return -1
+		} else if x.Conf < y.Conf {
+			return 1
+		}
+		return 0
+	})
+	// basePosition converts a candidate to base map coordinates
+	basePosition := func(c MapTrackerCandidate) (string, int, int) {
+		if m := i.findMap(c.MapName); m != nil {
+			return m.BaseName, c.X + m.BaseOffsetX, c.Y + m.BaseOffsetY
+		}
+		return c.MapName, c.X, c.Y
+	}
+	result := make([]MapTrackerCandidate, 0, INFER_TOP_K)
+	for _, c := range all {
+		name, x, y := basePosition(c)
+		suppressed := false
+		for _, o := range result {
+			oName, oX, oY := basePosition(o)
+			if oName == name && math.Hypot(float64(oX-x), float64(oY-y)) <= INFER_NMS_RADIUS {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			result = append(result, c)
+			if len(result) == INFER_TOP_K {
+				break
+			}
+		}
+	}
+	return result
+}
 
-		if matchVal > maxVal {
-			maxVal = matchVal
-			bestAngle = angle
+// inferLocationNear infers the player's location within a small window
+// around the last known location, on the same map and its sibling tier layers.
+// Distinct local maxima of the window are kept as well, so that the best candidate
+// has a runner-up to compute the confidence margin against.
+// Returns the candidates there sorted by confidence, or nil if nothing can be matched
+func (i *MapTrackerInfer) inferLocationNear(miniMap image.Image, mask *image.Gray, param *MapTrackerInferParam, last *trackState, mapNameRegex *regexp.Regexp) []MapTrackerCandidate {
+	lastMap := i.findMap(last.MapName)
+	if lastMap == nil {
+		return nil
+	}
+	lastBaseX, lastBaseY := last.X+lastMap.BaseOffsetX, last.Y+lastMap.BaseOffsetY
+
+	// Scale the mini-map to the target level only
+	target := pyramidLevel(param.Precision)
+	needle := newPyramidNeedle(miniMap, mask, PYRAMID_SCALES[target])
+	if needle.Stats.Dn < 1e-6 {
+		return nil
+	}
+
+	candidates := make([]MapTrackerCandidate, 0)
+	opts := NewMatchOptions(needle.W, needle.H, param.Precision, param.Backend)
+	for idx := range i.maps {
+		mapData := &i.maps[idx]
+		if mapData.BaseName != lastMap.BaseName {
+			continue
 		}
+		if mapData != lastMap && !mapNameRegex.MatchString(mapData.Name) {
+			continue
+		}
+
+		// Search window of top-left positions around the last location, in level coordinates
+		level := &mapData.Levels[target]
+		lastX, lastY := lastBaseX-mapData.BaseOffsetX, lastBaseY-mapData.BaseOffsetY
+		cx := int(float64(lastX-mapData.OffsetX)*level.Scale) - needle.W/2
+		cy := int(float64(lastY-mapData.OffsetY)*level.Scale) - needle.H/2
+		r := int(math.Ceil(TRACK_SEARCH_RADIUS * level.Scale))
+		region := image.Rect(cx-r, cy-r, cx+r+1, cy+r+1)
+		nmsDist := int(INFER_NMS_RADIUS * level.Scale)
+
+		for _, p := range MatchTemplateTopK(level.Img, level.Integral, needle.Img, needle.Stats, region, INFER_TOP_K, nmsDist, opts) {
+			x, y := pyramidCandidate{mapData, p.X, p.Y, p.Score}.mapPosition(needle)
+			candidates = append(candidates, MapTrackerCandidate{mapData.Name, x, y, p.Score})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
 	}
 
-	// Convert to clockwise angle
-	bestAngle = (360 - bestAngle) % 360
+	// The same location on sibling tier layers is a single candidate
+	return i.mergeCandidates(candidates, nil)
+}
 
-	return bestAngle, maxVal
+// inferRotation infers the player's rotation angle from the cropped pointer patch,
+// by circular correlation of the polar unwraps of the patch and the pointer template
+// Returns (angle in degrees within [0, 360), confidence)
+func (i *MapTrackerInfer) inferRotation(patch image.Image, dbg *inferDebug) (float64, float64) {
+	if i.pointerPol == nil || i.pointerPol.Dev < 1e-6 {
+		return 0, 0.0
+	}
+	angle, conf, scores := estimateRotation(ToRGBA(patch), i.pointerPol)
+	if dbg != nil {
+		dbg.RotScores = scores
+	}
+	return angle, conf
 }
@@ -0,0 +1,415 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unsafe"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Map cache file layout:
+//
+//	magic [8]byte | version uint32 | endian uint32 | hash [32]byte | index length uint64 |
+//	index JSON | padding to 8 bytes | data blocks (each aligned to 8 bytes)
+//
+// Data blocks are the raw RGBA pixels, the float64 integral images and the feature arrays
+// in native byte order, so that they can be used in place after the file is memory-mapped.
+var mapCacheMagic = [8]byte{'M', 'T', 'M', 'A', 'P', 'C', 'C', 0}
+
+// mapCacheEndian is written in native byte order to detect caches from other platforms
+const mapCacheEndian uint32 = 0x01020304
+
+// mapCacheHeader is the fixed-size header of a map cache file
+type mapCacheHeader struct {
+	Magic    [8]byte
+	Version  uint32
+	Endian   uint32
+	Hash     [32]byte
+	IndexLen uint64
+}
+
+// mapCacheIndex describes the content of a map cache file
+type mapCacheIndex struct {
+	Maps []mapCacheEntry `json:"maps"`
+	// Report holds the loaded maps and issues found when the cache was built
+	Report ResourceLoadReport `json:"report"`
+}
+
+// mapCacheEntry describes a cached map
+type mapCacheEntry struct {
+	Name        string          `json:"name"`
+	OffsetX     int             `json:"offsetX"`
+	OffsetY     int             `json:"offsetY"`
+	BaseName    string          `json:"baseName"`
+	Tier        string          `json:"tier"`
+	BaseOffsetX int             `json:"baseOffsetX"`
+	BaseOffsetY int             `json:"baseOffsetY"`
+	Image       mapCacheImage   `json:"image"`
+	Levels      []mapCacheLevel `json:"levels"`
+	Features    mapCacheFeature `json:"features"`
+}
+
+// mapCacheLevel describes a cached pyramid level
+type mapCacheLevel struct {
+	Scale float64       `json:"scale"`
+	Image mapCacheImage `json:"image"`
+}
+
+// mapCacheImage locates an image and its integral image in the data blocks
+type mapCacheImage struct {
+	W     int   `json:"w"`
+	H     int   `json:"h"`
+	Pix   int64 `json:"pix"`
+	Sum   int64 `json:"sum"`
+	SumSq int64 `json:"sumSq"`
+}
+
+// mapCacheFeature locates the features of a map in the data blocks
+type mapCacheFeature struct {
+	Count  int   `json:"count"`
+	Points int64 `json:"points"`
+	Descs  int64 `json:"descs"`
+}
+
+// hashMapDir computes the content hash of the map directory, covering all map images,
+// map_rect.json and the parameters that affect the preprocessed data
+func hashMapDir(mapDir string) ([32]byte, error) {
+	entries, err := os.ReadDir(mapDir)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("failed to read map directory: %w", err)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "version=%d scales=%v minimap=%d\n", MAP_CACHE_VERSION, PYRAMID_SCALES, DEFAULT_GEOMETRY.Minimap.Radius)
+	fmt.Fprintf(h, "features=%d,%d,%d,%d,%d,%d\n", FEATURE_FAST_THRESHOLD, FEATURE_GRID_CELL, FEATURE_PER_CELL,
+		FEATURE_PATCH_RADIUS, FEATURE_SMOOTH_RADIUS, FEATURE_PATTERN_SEED)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || (!strings.HasSuffix(name, ".png") && name != "map_rect.json") {
+			continue
+		}
+		file, err := os.Open(filepath.Join(mapDir, name))
+		if err != nil {
+			return [32]byte{}, err
+		}
+		fmt.Fprintf(h, "%s\n", name)
+		_, err = io.Copy(h, file)
+		file.Close()
+		if err != nil {
+			return [32]byte{}, err
+		}
+	}
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// getMapCachePath returns the cache file path for the given content hash
+func getMapCachePath(hash [32]byte) string {
+	return filepath.Join(MAP_CACHE_DIR, fmt.Sprintf("maps_%s.bin", hex.EncodeToString(hash[:8])))
+}
+
+// openMapCache memory-maps the cache file of the given hash and builds the maps on top of it.
+// The issues recorded when the cache was built are restored into the report.
+// The returned mapping must be kept open while the maps are in use.
+func openMapCache(hash [32]byte, report *ResourceLoadReport) ([]MapCache, *mappedFile, error) {
+	mf, err := mmapFile(getMapCachePath(hash))
+	if err != nil {
+		return nil, nil, err
+	}
+	maps, err := parseMapCache(mf.data, hash, report)
+	if err != nil {
+		mf.Close()
+		return nil, nil, err
+	}
+	return maps, mf, nil
+}
+
+func parseMapCache(data []byte, hash [32]byte, report *ResourceLoadReport) ([]MapCache, error) {
+	var header mapCacheHeader
+	headerLen := binary.Size(header)
+	if len(data) < headerLen {
+		return nil, fmt.Errorf("cache file is truncated")
+	}
+	if _, err := binary.Decode(data, binary.NativeEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to decode cache header: %w", err)
+	}
+	if header.Magic != mapCacheMagic || header.Endian != mapCacheEndian {
+		return nil, fmt.Errorf("not a map cache file of this platform")
+	}
+	if header.Version != MAP_CACHE_VERSION {
+		return nil, fmt.Errorf("cache version %d does not match %d", header.Version, MAP_CACHE_VERSION)
+	}
+	if header.Hash != hash {
+		return nil, fmt.Errorf("cache hash does not match the map directory")
+	}
+	if uint64(len(data)-headerLen) < header.IndexLen {
+		return nil, fmt.Errorf("cache file is truncated")
+	}
+	var index mapCacheIndex
+	if err := json.Unmarshal(data[headerLen:headerLen+int(header.IndexLen)], &index); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cache index: %w", err)
+	}
+
+	maps := make([]MapCache, 0, len(index.Maps))
+	for _, e := range index.Maps {
+		img, integral, err := viewCachedImage(data, e.Image)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cached map %s: %w", e.Name, err)
+		}
+		m := MapCache{
+			Name:        e.Name,
+			Img:         img,
+			Integral:    integral,
+			OffsetX:     e.OffsetX,
+			OffsetY:     e.OffsetY,
+			BaseName:    e.BaseName,
+			Tier:        e.Tier,
+			BaseOffsetX: e.BaseOffsetX,
+			BaseOffsetY: e.BaseOffsetY,
+		}
+		for _, l := range e.Levels {
+			img, integral, err := viewCachedImage(data, l.Image)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cached level of map %s: %w", e.Name, err)
+			}
+			m.Levels = append(m.Levels, MapLevel{l.Scale, img, integral})
+		}
+		if len(m.Levels) != len(PYRAMID_SCALES) {
+			return nil, fmt.Errorf("cached map %s has %d levels, expected %d", e.Name, len(m.Levels), len(PYRAMID_SCALES))
+		}
+		points, ok1 := viewCachedSlice[featurePoint](data, e.Features.Points, e.Features.Count)
+		descs, ok2 := viewCachedSlice[featureDesc](data, e.Features.Descs, e.Features.Count)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("invalid cached features of map %s: data block out of range", e.Name)
+		}
+		m.Features = mapFeatures{points, descs}
+		maps = append(maps, m)
+	}
+
+	report.Maps = index.Report.Maps
+	report.Issues = append(report.Issues, index.Report.Issues...)
+	return maps, nil
+}
+
+// viewCachedImage creates the image and the integral image backed by the data blocks
+func viewCachedImage(data []byte, ci mapCacheImage) (*image.RGBA, *IntegralImage, error) {
+	if ci.W <= 0 || ci.H <= 0 {
+		return nil, nil, fmt.Errorf("invalid image size %dx%d", ci.W, ci.H)
+	}
+	sumLen := (ci.W + 1) * (ci.H + 1)
+	pix, ok1 := viewCachedSlice[uint8](data, ci.Pix, ci.W*ci.H*4)
+	sum, ok2 := viewCachedSlice[float64](data, ci.Sum, sumLen)
+	sumSq, ok3 := viewCachedSlice[float64](data, ci.SumSq, sumLen)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, nil, fmt.Errorf("data block out of range")
+	}
+	img := &image.RGBA{Pix: pix, Stride: ci.W * 4, Rect: image.Rect(0, 0, ci.W, ci.H)}
+	integral := &IntegralImage{Sum: sum, SumSq: sumSq, W: ci.W, H: ci.H}
+	return img, integral, nil
+}
+
+// viewCachedSlice returns the slice of n elements at offset backed by the data blocks,
+// or false if it is out of range or misaligned
+func viewCachedSlice[T any](data []byte, offset int64, n int) ([]T, bool) {
+	size := int64(unsafe.Sizeof(*new(T)))
+	if offset < 0 || offset%8 != 0 || n < 0 || offset+int64(n)*size > int64(len(data)) {
+		return nil, false
+	}
+	if n == 0 {
+		return nil, true
+	}
+	return unsafe.Slice((*T)(unsafe.Pointer(&data[offset])), n), true
+}
+
+// cacheBlockBytes returns the raw bytes of a data block
+func cacheBlockBytes[T any](s []T) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(s))), len(s)*int(unsafe.Sizeof(*new(T))))
+}
+
+// writeMapCache writes the preprocessed maps into the cache file of the given hash,
+// and removes the cache files of other hashes.
+// Returns the path of the written file.
+func writeMapCache(hash [32]byte, maps []MapCache, report *ResourceLoadReport) (string, error) {
+	index := mapCacheIndex{Report: ResourceLoadReport{Maps: report.Maps, Issues: report.Issues}}
+	var blocks [][]byte
+	offset := int64(0)
+	// addBlock lays out a data block, with the offset relative to the data section
+	addBlock := func(block []byte) int64 {
+		start := offset
+		offset = alignTo8(offset + int64(len(block)))
+		blocks = append(blocks, block)
+		return start
+	}
+	written := make(map[*image.RGBA]mapCacheImage)
+	// addImage lays out the data blocks of an image once
+	addImage := func(img *image.RGBA, integral *IntegralImage) mapCacheImage {
+		if ci, ok := written[img]; ok {
+			return ci
+		}
+		w, h := img.Rect.Dx(), img.Rect.Dy()
+		pix := img.Pix
+		if img.Stride != w*4 || len(pix) != w*h*4 {
+			pix = cloneRGBA(img).Pix
+		}
+		ci := mapCacheImage{
+			W:     w,
+			H:     h,
+			Pix:   addBlock(pix),
+			Sum:   addBlock(cacheBlockBytes(integral.Sum)),
+			SumSq: addBlock(cacheBlockBytes(integral.SumSq)),
+		}
+		written[img] = ci
+		return ci
+	}
+	for _, m := range maps {
+		e := mapCacheEntry{
+			Name:        m.Name,
+			OffsetX:     m.OffsetX,
+			OffsetY:     m.OffsetY,
+			BaseName:    m.BaseName,
+			Tier:        m.Tier,
+			BaseOffsetX: m.BaseOffsetX,
+			BaseOffsetY: m.BaseOffsetY,
+			Image:       addImage(m.Img, m.Integral),
+			Features: mapCacheFeature{
+				Count:  len(m.Features.Points),
+				Points: addBlock(cacheBlockBytes(m.Features.Points)),
+				Descs:  addBlock(cacheBlockBytes(m.Features.Descs)),
+			},
+		}
+		for _, l := range m.Levels {
+			e.Levels = append(e.Levels, mapCacheLevel{l.Scale, addImage(l.Img, l.Integral)})
+		}
+		index.Maps = append(index.Maps, e)
+	}
+
+	// Shift the data offsets behind the header and the index.
+	// The index length depends on the offsets, so grow the reserved space until it is stable.
+	header := mapCacheHeader{mapCacheMagic, MAP_CACHE_VERSION, mapCacheEndian, hash, 0}
+	dataStart := alignTo8(int64(binary.Size(header)))
+	var indexJSON []byte
+	var err error
+	for {
+		shifted := shiftCacheIndex(index, dataStart)
+		indexJSON, err = json.Marshal(shifted)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal cache index: %w", err)
+		}
+		if need := alignTo8(int64(binary.Size(header)) + int64(len(indexJSON))); need <= dataStart {
+			break
+		} else {
+			dataStart = need
+		}
+	}
+	header.IndexLen = uint64(dataStart) - uint64(binary.Size(header))
+	// Pad the index with spaces, which are ignored by the JSON decoder
+	for len(indexJSON) < int(header.IndexLen) {
+		indexJSON = append(indexJSON, ' ')
+	}
+
+	if err := os.MkdirAll(MAP_CACHE_DIR, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	path := getMapCachePath(hash)
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cache file: %w", err)
+	}
+	w := bufio.NewWriterSize(file, 1<<20)
+	err = binary.Write(w, binary.NativeEndian, &header)
+	if err == nil {
+		_, err = w.Write(indexJSON)
+	}
+	pos := dataStart
+	for _, raw := range blocks {
+		if err != nil {
+			break
+		}
+		if pad := alignTo8(pos) - pos; pad > 0 {
+			_, err = w.Write(make([]byte, pad))
+			pos += pad
+		}
+		if err == nil {
+			_, err = w.Write(raw)
+			pos += int64(len(raw))
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to rename cache file: %w", err)
+	}
+
+	removeStaleMapCaches(path)
+	return path, nil
+}
+
+// shiftCacheIndex returns a copy of the index with data offsets moved by delta
+func shiftCacheIndex(index mapCacheIndex, delta int64) mapCacheIndex {
+	shift := func(ci mapCacheImage) mapCacheImage {
+		ci.Pix += delta
+		ci.Sum += delta
+		ci.SumSq += delta
+		return ci
+	}
+	shifted := index
+	shifted.Maps = slices.Clone(index.Maps)
+	for idx := range shifted.Maps {
+		e := &shifted.Maps[idx]
+		e.Image = shift(e.Image)
+		e.Features.Points += delta
+		e.Features.Descs += delta
+		e.Levels = slices.Clone(e.Levels)
+		for l := range e.Levels {
+			e.Levels[l].Image = shift(e.Levels[l].Image)
+		}
+	}
+	return shifted
+}
+
+// removeStaleMapCaches removes the cache files other than the given one.
+// Files still mapped by a running agent may fail to be removed, which is ignored.
+func removeStaleMapCaches(keep string) {
+	matches, _ := filepath.Glob(filepath.Join(MAP_CACHE_DIR, "maps_*.bin"))
+	for _, path := range matches {
+		if path != keep {
+			if err := os.Remove(path); err == nil {
+				log.Debug().Str("path", path).Msg("Stale map cache removed")
+			}
+		}
+	}
+}
+
+func alignTo8(v int64) int64 {
+	return (v + 7) &^ 7
+}
+
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, img.Rect.Dx(), img.Rect.Dy()))
+	for y := 0; y < dst.Rect.Dy(); y++ {
+		copy(dst.Pix[y*dst.Stride:(y+1)*dst.Stride], img.Pix[img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y):])
+	}
+	return dst
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// maskRun is a horizontal run [X0, X1) of used pixels on row Y of a mask
+type maskRun struct {
+	Y, X0, X1 int
+}
+
+// calcMaskRuns returns the runs of used pixels of the mask, row by row,
+// where pixels of at least MASK_THRESHOLD are used
+func calcMaskRuns(mask *image.Gray) []maskRun {
+	w, h := mask.Rect.Dx(), mask.Rect.Dy()
+	runs := make([]maskRun, 0, h)
+	for y := 0; y < h; y++ {
+		row := mask.Pix[y*mask.Stride : y*mask.Stride+w]
+		for x := 0; x < w; {
+			if row[x] < MASK_THRESHOLD {
+				x++
+				continue
+			}
+			x0 := x
+			for x < w && row[x] >= MASK_THRESHOLD {
+				x++
+			}
+			runs = append(runs, maskRun{y, x0, x})
+		}
+	}
+	return runs
+}
+
+// scaleMask scales the mask to the given size with nearest neighbor sampling
+func scaleMask(mask *image.Gray, w, h int) *image.Gray {
+	if mask.Rect.Dx() == w && mask.Rect.Dy() == h {
+		return mask
+	}
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	xdraw.NearestNeighbor.Scale(dst, dst.Bounds(), mask, mask.Rect, xdraw.Src, nil)
+	return dst
+}
+
+// buildMinimapMask builds the mask of the mini-map crop of the geometry, in map pixel scale.
+// It keeps the circle inscribed in the crop, without the player pointer,
+// and intersects it with the resource mask image if not nil.
+func buildMinimapMask(g *MinimapGeometry, res *image.Gray) *image.Gray {
+	s := g.scale()
+	size := 2*g.Minimap.Radius + 1
+	w, h := int(float64(size)/s), int(float64(size)/s)
+	cx, cy := float64(w)/2, float64(h)/2
+	outer := float64(g.Minimap.Radius) / s
+	px, py := cx+float64(g.Pointer.X-g.Minimap.X)/s, cy+float64(g.Pointer.Y-g.Minimap.Y)/s
+	inner := float64(g.Pointer.Radius) / s
+
+	mask := image.NewGray(image.Rect(0, 0, w, h))
+	if res != nil {
+		res = scaleMask(res, w, h)
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)+0.5, float64(y)+0.5
+			if math.Hypot(fx-cx, fy-cy) > outer || math.Hypot(fx-px, fy-py) <= inner {
+				continue
+			}
+			if res != nil && res.Pix[y*res.Stride+x] < MASK_THRESHOLD {
+				continue
+			}
+			mask.Pix[y*mask.Stride+x] = 255
+		}
+	}
+	return mask
+}
+
+// loadMaskImage loads a mask image from the resource path, where opaque bright pixels are used
+func loadMaskImage(path string) (*image.Gray, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mask image: %w", err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode mask image: %w", err)
+	}
+	b := img.Bounds()
+	mask := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			r, g, bl, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			luma := (299*r + 587*g + 114*bl) / 1000
+			if a >= 0x8000 && luma >= 0x8000 {
+				mask.Pix[y*mask.Stride+x] = 255
+			}
+		}
+	}
+	return mask, nil
+}
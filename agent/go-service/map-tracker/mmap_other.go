@@ -0,0 +1,48 @@
+// Copyright (c) 2026 Harry Huang
+
+//go:build !windows
+
+package maptracker
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mappedFile is a read-only memory-mapped file
+type mappedFile struct {
+	data []byte
+}
+
+// mmapFile maps the whole file into memory for reading
+func mmapFile(path string) (*mappedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return nil, fmt.Errorf("file %s is empty", path)
+	}
+	data, err := unix.Mmap(int(file.Fd()), 0, int(info.Size()), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map file: %w", err)
+	}
+	return &mappedFile{data}, nil
+}
+
+// Close unmaps the file, after which the data must not be accessed
+func (m *mappedFile) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := unix.Munmap(m.data)
+	m.data = nil
+	return err
+}
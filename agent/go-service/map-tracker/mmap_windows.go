@@ -0,0 +1,59 @@
+// Copyright (c) 2026 Harry Huang
+
+//go:build windows
+
+package maptracker
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// mappedFile is a read-only memory-mapped file
+type mappedFile struct {
+	data []byte
+	addr uintptr
+}
+
+// mmapFile maps the whole file into memory for reading
+func mmapFile(path string) (*mappedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, fmt.Errorf("file %s is empty", path)
+	}
+
+	// The view keeps the mapping alive after both handles are closed
+	mapping, err := windows.CreateFileMapping(windows.Handle(file.Fd()), nil, windows.PAGE_READONLY, uint32(size>>32), uint32(size), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file mapping: %w", err)
+	}
+	defer windows.CloseHandle(mapping)
+	addr, err := windows.MapViewOfFile(mapping, windows.FILE_MAP_READ, 0, 0, uintptr(size))
+	if err != nil {
+		return nil, fmt.Errorf("failed to map view of file: %w", err)
+	}
+	// Convert through a pointer to avoid the uintptr to unsafe.Pointer conversion check
+	ptr := *(*unsafe.Pointer)(unsafe.Pointer(&addr))
+	return &mappedFile{unsafe.Slice((*byte)(ptr), size), addr}, nil
+}
+
+// Close unmaps the file, after which the data must not be accessed
+func (m *mappedFile) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	m.data = nil
+	return windows.UnmapViewOfFile(m.addr)
+}
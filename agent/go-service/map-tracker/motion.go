@@ -0,0 +1,124 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"math"
+	"time"
+)
+
+// motionEstimate is the smoothed motion state of the player
+type motionEstimate struct {
+	// X and Y are the smoothed position.
+	X float64
+	Y float64
+	// VX and VY are the velocity in map pixels per second.
+	VX float64
+	VY float64
+	// Heading is the direction of movement (0-359 degrees, clockwise from up), valid only if Moving is true.
+	Heading int
+	Moving  bool
+}
+
+// axisKalman is a constant-velocity Kalman filter on one axis
+type axisKalman struct {
+	pos, vel float64
+	p        [2][2]float64
+}
+
+func (k *axisKalman) reset(pos float64) {
+	k.pos, k.vel = pos, 0
+	k.p = [2][2]float64{{MOTION_MEASURE_NOISE * MOTION_MEASURE_NOISE, 0}, {0, MOTION_INIT_SPEED_VAR}}
+}
+
+func (k *axisKalman) predict(dt float64) {
+	k.pos += k.vel * dt
+	// P = F P F' + Q, with F = [[1, dt], [0, 1]] and white noise acceleration
+	p := k.p
+	q := MOTION_ACCEL_NOISE * MOTION_ACCEL_NOISE
+	k.p[0][0] = p[0][0] + dt*(p[1][0]+p[0][1]) + dt*dt*p[1][1] + q*dt*dt*dt*dt/4
+	k.p[0][1] = p[0][1] + dt*p[1][1] + q*dt*dt*dt/2
+	k.p[1][0] = p[1][0] + dt*p[1][1] + q*dt*dt*dt/2
+	k.p[1][1] = p[1][1] + q*dt*dt
+}
+
+func (k *axisKalman) update(z, r float64) {
+	// H = [1, 0]
+	s := k.p[0][0] + r
+	k0, k1 := k.p[0][0]/s, k.p[1][0]/s
+	y := z - k.pos
+	k.pos += k0 * y
+	k.vel += k1 * y
+	p := k.p
+	k.p[0][0] = (1 - k0) * p[0][0]
+	k.p[0][1] = (1 - k0) * p[0][1]
+	k.p[1][0] = p[1][0] - k1*p[0][0]
+	k.p[1][1] = p[1][1] - k1*p[0][1]
+}
+
+// motionFilter smooths inferred locations with a constant-velocity Kalman filter
+// and rejects physically impossible jumps with a max-speed gate
+type motionFilter struct {
+	maxSpeed    float64
+	x, y        axisKalman
+	lastTime    time.Time
+	initialized bool
+	rejections  int
+}
+
+func newMotionFilter(maxSpeed float64) *motionFilter {
+	return &motionFilter{maxSpeed: maxSpeed}
+}
+
+// reset forgets the motion state, e.g. after the player is teleported
+func (f *motionFilter) reset() {
+	f.initialized = false
+	f.rejections = 0
+}
+
+// update feeds an inferred location with its confidence at the given time.
+// Returns the smoothed estimate and whether the location was accepted.
+// After MOTION_MAX_REJECTIONS rejections in a row, the filter restarts from the location.
+func (f *motionFilter) update(x, y int, conf float64, now time.Time) (motionEstimate, bool) {
+	zx, zy := float64(x), float64(y)
+	if !f.initialized {
+		f.x.reset(zx)
+		f.y.reset(zy)
+		f.lastTime, f.initialized, f.rejections = now, true, 0
+		return f.estimate(), true
+	}
+
+	dt := max(now.Sub(f.lastTime).Seconds(), 1e-3)
+	f.lastTime = now
+	f.x.predict(dt)
+	f.y.predict(dt)
+
+	// Gate by the distance reachable from the predicted position
+	if math.Hypot(zx-f.x.pos, zy-f.y.pos) > f.maxSpeed*dt+MOTION_GATE_SLACK {
+		f.rejections++
+		if f.rejections < MOTION_MAX_REJECTIONS {
+			return f.estimate(), false
+		}
+		// Consistently far away, so the filter itself is more likely wrong
+		f.x.reset(zx)
+		f.y.reset(zy)
+		f.rejections = 0
+		return f.estimate(), true
+	}
+	f.rejections = 0
+
+	// Less confident matches are trusted less
+	sigma := MOTION_MEASURE_NOISE / max(conf, 0.1)
+	f.x.update(zx, sigma*sigma)
+	f.y.update(zy, sigma*sigma)
+	return f.estimate(), true
+}
+
+func (f *motionFilter) estimate() motionEstimate {
+	e := motionEstimate{X: f.x.pos, Y: f.y.pos, VX: f.x.vel, VY: f.y.vel}
+	if math.Hypot(e.VX, e.VY) >= MOTION_MIN_SPEED {
+		e.Moving = true
+		deg := math.Atan2(e.VX, -e.VY) * 180.0 / math.Pi
+		e.Heading = (int(math.Round(deg)) + 360) % 360
+	}
+	return e
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const motionTestInterval = 200 * time.Millisecond
+
+// walkMotionFilter feeds n locations moving by (dx, dy) per interval from (x, y),
+// failing the test if any of them is rejected. Returns the time of the last update.
+func walkMotionFilter(t *testing.T, f *motionFilter, x, y, dx, dy, n int, now time.Time) time.Time {
+	t.Helper()
+	for step := 0; step < n; step++ {
+		if _, accepted := f.update(x+dx*step, y+dy*step, 1.0, now); !accepted {
+			t.Fatalf("location %d (%d, %d) rejected", step, x+dx*step, y+dy*step)
+		}
+		now = now.Add(motionTestInterval)
+	}
+	return now.Add(-motionTestInterval)
+}
+
+func TestMotionFilterRejectsJump(t *testing.T) {
+	f := newMotionFilter(60.0)
+	now := walkMotionFilter(t, f, 100, 100, 4, 0, 10, time.Unix(0, 0))
+
+	now = now.Add(motionTestInterval)
+	est, accepted := f.update(300, 100, 1.0, now)
+	if accepted {
+		t.Fatal("200 px jump accepted")
+	}
+	if math.Abs(est.X-140) > 8 || math.Abs(est.Y-100) > 8 {
+		t.Errorf("estimate (%.1f, %.1f) moved by the rejected jump, want near (140, 100)", est.X, est.Y)
+	}
+
+	// The next plausible location is accepted again
+	now = now.Add(motionTestInterval)
+	if _, accepted := f.update(144, 100, 1.0, now); !accepted {
+		t.Error("plausible location after the jump rejected")
+	}
+}
+
+func TestMotionFilterRestartsAfterRejections(t *testing.T) {
+	f := newMotionFilter(60.0)
+	now := walkMotionFilter(t, f, 100, 100, 0, 0, 5, time.Unix(0, 0))
+
+	for n := 1; n <= MOTION_MAX_REJECTIONS; n++ {
+		now = now.Add(motionTestInterval)
+		est, accepted := f.update(400, 400, 1.0, now)
+		if n < MOTION_MAX_REJECTIONS {
+			if accepted {
+				t.Fatalf("far location accepted after %d rejections, want %d", n-1, MOTION_MAX_REJECTIONS-1)
+			}
+			continue
+		}
+		if !accepted {
+			t.Fatalf("far location still rejected after %d rejections", n-1)
+		}
+		if est.X != 400 || est.Y != 400 || est.Moving {
+			t.Errorf("filter not restarted at the far location, estimate %+v", est)
+		}
+	}
+}
+
+func TestMotionFilterReset(t *testing.T) {
+	f := newMotionFilter(60.0)
+	now := walkMotionFilter(t, f, 100, 100, 4, 0, 10, time.Unix(0, 0))
+
+	// e.g. after a run_node action teleported the player
+	f.reset()
+	est, accepted := f.update(800, 600, 1.0, now.Add(motionTestInterval))
+	if !accepted {
+		t.Fatal("location after reset rejected")
+	}
+	if est.X != 800 || est.Y != 600 || est.Moving {
+		t.Errorf("filter not restarted after reset, estimate %+v", est)
+	}
+}
+
+func TestMotionFilterHeading(t *testing.T) {
+	cases := []struct {
+		name    string
+		dx, dy  int
+		heading int
+	}{
+		{"north", 0, -4, 0},
+		{"east", 4, 0, 90},
+		{"south", 0, 4, 180},
+		{"west", -4, 0, 270},
+		{"south-east", 3, 3, 135},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f := newMotionFilter(60.0)
+			walkMotionFilter(t, f, 500, 500, c.dx, c.dy, 15, time.Unix(0, 0))
+			est := f.estimate()
+			if !est.Moving {
+				t.Fatalf("not moving, estimate %+v", est)
+			}
+			if d := calcDeltaRotation(c.heading, est.Heading); absInt(d) > 5 {
+				t.Errorf("heading %d, want %d", est.Heading, c.heading)
+			}
+		})
+	}
+
+	f := newMotionFilter(60.0)
+	walkMotionFilter(t, f, 500, 500, 0, 0, 15, time.Unix(0, 0))
+	if est := f.estimate(); est.Moving {
+		t.Errorf("standing still reported as moving, estimate %+v", est)
+	}
+}
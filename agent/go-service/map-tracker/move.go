@@ -5,8 +5,8 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"image"
 	"math"
-	"regexp"
 	"time"
 
 	"github.com/MaaXYZ/MaaEnd/agent/go-service/pkg/maafocus"
@@ -19,9 +19,11 @@ type MapTrackerMove struct{}
 // MapTrackerMoveParam represents the custom_action_param for MapTrackerMove
 type MapTrackerMoveParam struct {
 	// MapName is the name of the map to navigate (required).
+	// If it is a base map, the path may cross its tier layers, using base map coordinates.
+	// Waypoints may switch to other maps partway through the path.
 	MapName string `json:"map_name"`
-	// Path is a sequence of [x, y] coordinate points to follow (required).
-	Path [][2]int `json:"path"`
+	// Path is a sequence of waypoints to follow (required).
+	Path []Waypoint `json:"path"`
 	// ArrivalThreshold is the minimum distance to consider a target reached.
 	ArrivalThreshold float64 `json:"arrival_threshold,omitempty"`
 	// ArrivalTimeout is the maximum allowed time in milliseconds to reach each target point.
@@ -40,13 +42,42 @@ type MapTrackerMoveParam struct {
 	StuckThreshold int64 `json:"stuck_threshold,omitempty"`
 	// StuckTimeout is the maximum time in milliseconds to tolerate being stuck.
 	StuckTimeout int64 `json:"stuck_timeout,omitempty"`
+	// StuckRecovery is the sequence of maneuvers to try in turn while stuck, e.g. "jump" and "strafe_left".
+	StuckRecovery []string `json:"stuck_recovery,omitempty"`
+	// Recovery is the strategy to apply when navigation fails, one of "none", "retry", "backoff", "replan" and "teleport".
+	Recovery string `json:"recovery,omitempty"`
+	// MaxRetries is the maximum number of recovery attempts.
+	MaxRetries int `json:"max_retries,omitempty"`
+	// TeleportNode is the pipeline node to run for the "teleport" recovery strategy.
+	TeleportNode string `json:"teleport_node,omitempty"`
+	// OnFailure decides what to do when navigation finally fails, one of "stop" and "error".
+	OnFailure string `json:"on_failure,omitempty"`
+	// Steering is the steering mode, one of "step" and "pursuit".
+	Steering string `json:"steering,omitempty"`
+	// Lookahead is the lookahead distance along the path for the "pursuit" steering mode.
+	Lookahead float64 `json:"lookahead,omitempty"`
+	// MaxSpeed is the maximum plausible player speed in map pixels per second, used to reject bad locations.
+	MaxSpeed float64 `json:"max_speed,omitempty"`
+	// Whether to disable the motion filter and use inferred locations as is.
+	NoMotionFilter bool `json:"no_motion_filter,omitempty"`
+	// TransitionTimeout is the maximum time in milliseconds to wait for transition screens and map switches,
+	// during which the other timers are paused.
+	TransitionTimeout int64 `json:"transition_timeout,omitempty"`
+	// Debug enables writing a trajectory image of the path and the actual positions to the debug directory.
+	Debug bool `json:"debug,omitempty"`
 	// Whether to suppress status printing for GUI.
 	NoPrint bool `json:"no_print,omitempty"`
+
+	// trace records the actual positions in debug mode
+	trace *moveTrace
 }
 
 //go:embed messages/emergency_stop.html
 var emergencyStopHTML string
 
+//go:embed messages/navigation_failed.html
+var navigationFailedHTML string
+
 //go:embed messages/navigation_moving.html
 var navigationMovingHTML string
 
@@ -64,20 +95,136 @@ func (a *MapTrackerMove) Run(ctx *maa.Context, arg *maa.CustomActionArg) bool {
 		return false
 	}
 
+	return doMove(ctx, param) == nil
+}
+
+// doMove drives the player along param.Path, applying the recovery strategy on failures.
+// Returns nil if all target points are reached, or the final failure otherwise.
+func doMove(ctx *maa.Context, param *MapTrackerMoveParam) *MoveFailure {
 	ctrl := ctx.GetTasker().GetController()
 	aw := NewActionWrapper(ctx, ctrl)
-	inferIntervalDuration := time.Duration(INFER_INTERVAL_MS) * time.Millisecond
+	tasker := *ctx.GetTasker()
 
 	log.Info().Str("map", param.MapName).Int("targets_count", len(param.Path)).Msg("Starting navigation to targets")
 
+	if param.Debug {
+		param.trace = &moveTrace{}
+		defer func() { param.trace = nil }()
+	}
+
+	startIndex := 0
+	var failure *MoveFailure
+	for attempt := 0; ; attempt++ {
+		failure = moveAlong(ctx, aw, param, startIndex)
+		if failure == nil {
+			break
+		}
+		failure.Retries = attempt
+		setMoveFailure(tasker, failure)
+		if failure.Reason == MOVE_FAILURE_STOPPING || param.Recovery == RECOVERY_NONE || attempt >= param.MaxRetries {
+			break
+		}
+
+		log.Warn().
+			Str("reason", failure.Reason).
+			Int("index", failure.Index).
+			Str("recovery", param.Recovery).
+			Int("attempt", attempt+1).
+			Msg("Navigation failed, recovering")
+		next, err := doRecover(ctx, aw, param, failure)
+		if err != nil {
+			log.Error().Err(err).Str("recovery", param.Recovery).Msg("Recovery failed")
+			break
+		}
+		startIndex = next
+	}
+
+	if param.trace != nil {
+		if path, err := writeMoveDebug(param, param.trace, failure); err != nil {
+			log.Warn().Err(err).Msg("Failed to write navigation debug image")
+		} else {
+			log.Info().Str("path", path).Msg("Navigation debug image written")
+		}
+	}
+
+	if failure != nil {
+		if failure.Reason != MOVE_FAILURE_STOPPING {
+			doFailureExit(aw, param, failure)
+		}
+		return failure
+	}
+
+	clearMoveFailure(tasker)
+
+	// Show finished UI summary
+	if !param.NoPrint {
+		maafocus.NodeActionStarting(
+			aw.ctx,
+			fmt.Sprintf(navigationFinishedHTML, len(param.Path)),
+		)
+	}
+
+	return nil
+}
+
+// moveAlong runs the movement loop over param.Path from the given index.
+// Returns nil if all remaining target points are reached, or the failure otherwise.
+func moveAlong(ctx *maa.Context, aw *ActionWrapper, param *MapTrackerMoveParam, startIndex int) *MoveFailure {
+	ctrl := aw.ctrl
+	inferIntervalDuration := time.Duration(INFER_INTERVAL_MS) * time.Millisecond
+	var lastLocation *[2]int
+	var motion *motionFilter
+	if !param.NoMotionFilter {
+		motion = newMotionFilter(param.MaxSpeed)
+	}
+	var pursuit *pursuitController
+	if param.Steering == STEERING_PURSUIT {
+		pursuit = newPursuitController(*ctx.GetTasker(), param)
+	}
+
 	// For each target point
-	for i, target := range param.Path {
-		targetX, targetY := target[0], target[1]
+targets:
+	for i := startIndex; i < len(param.Path); i++ {
+		target := param.Path[i]
+		targetX, targetY := target.X, target.Y
 		log.Info().Int("index", i).Int("targetX", targetX).Int("targetY", targetY).Msg("Navigating to next target point")
 
+		// The map of the target point, and the map left behind if the path switches maps on the way
+		mapName := param.waypointMap(i)
+		prevMapName := mapName
+		if i > 0 {
+			prevMapName = param.waypointMap(i - 1)
+		}
+		crossing := !isSameBaseMap(prevMapName, mapName)
+		inferRegex := calcMapNamesRegex([]string{mapName})
+		if crossing {
+			log.Info().Str("from", prevMapName).Str("to", mapName).Msg("Map switch expected on the way to target point")
+			inferRegex = calcMapNamesRegex([]string{prevMapName, mapName})
+			lastLocation = nil
+			if motion != nil {
+				motion.reset()
+			}
+		}
+
+		fail := func(reason string) *MoveFailure {
+			aw.KeyUpSync(KEY_W, 100)
+			f := &MoveFailure{Reason: reason, MapName: mapName, Index: i, Target: target.Point()}
+			if lastLocation != nil {
+				f.Located = true
+				f.X, f.Y = lastLocation[0], lastLocation[1]
+			}
+			if motion != nil && motion.initialized {
+				est := motion.estimate()
+				f.Moving, f.Heading = est.Moving, est.Heading
+			}
+			return f
+		}
+
 		// Show navigation UI
-		if initRes, err := doInfer(ctx, ctrl, param); err == nil && initRes != nil {
-			initDist := math.Hypot(float64(initRes.X-targetX), float64(initRes.Y-targetY))
+		if initRes, err := doInferRegex(ctx, ctrl, inferRegex); err == nil && isSameBaseMap(initRes.BaseMap, mapName) {
+			initX, initY := calcFramePosition(initRes, mapName)
+			lastLocation = &[2]int{initX, initY}
+			initDist := math.Hypot(float64(initX-targetX), float64(initY-targetY))
 			if !param.NoPrint {
 				maafocus.NodeActionStarting(
 					aw.ctx,
@@ -88,12 +235,34 @@ func (a *MapTrackerMove) Run(ctx *maa.Context, arg *maa.CustomActionArg) bool {
 			log.Debug().Err(err).Msg("Initial infer failed for moving UI")
 		}
 
+		// The segment starts from the previous target point on the same map, or the initial location
+		fromX, fromY := targetX, targetY
+		if i > startIndex && !crossing {
+			fromX, fromY = param.Path[i-1].X, param.Path[i-1].Y
+		} else if lastLocation != nil {
+			fromX, fromY = lastLocation[0], lastLocation[1]
+		}
+
+		arrivalThreshold := param.ArrivalThreshold
+		if target.Tolerance > 0 {
+			arrivalThreshold = target.Tolerance
+		}
+		stuckRecovery := param.StuckRecovery
+		if len(target.StuckRecovery) > 0 {
+			stuckRecovery = target.StuckRecovery
+		}
+
 		var (
+			stuckStep              = 0
 			lastInferTime          = time.Time{}
 			lastRotationAdjustTime = time.Time{}
 			lastArrivalTime        = time.Now()
 			prevLocationTime       = time.Time{}
 			prevLocation           *[2]int
+			prevTier               *string
+			passed                 = false
+			pausedSince            = time.Time{}
+			misses                 = 0
 		)
 
 		for {
@@ -108,71 +277,191 @@ func (a *MapTrackerMove) Run(ctx *maa.Context, arg *maa.CustomActionArg) bool {
 			// Check stopping signal
 			if ctx.GetTasker().Stopping() {
 				log.Warn().Msg("Task is stopping, exiting navigation loop")
-				aw.KeyUpSync(KEY_W, 100)
-				return false
+				return fail(MOVE_FAILURE_STOPPING)
+			}
+
+			// Capture the screen and run inference to get current location and rotation,
+			// unless the screen is in a transition
+			var result *MapTrackerInferResult
+			transition := ""
+			img, err := captureScreen(ctrl)
+			if err == nil {
+				if transition = detectScreenTransition(img); transition == "" {
+					result, err = doInferImage(ctx, img, inferRegex)
+				}
 			}
 
-			// Check arrival timeout
+			// Pause the timers during transition screens, and while the location is lost
+			// when crossing to another map, where loading may take a while
+			if transition != "" || (err != nil && crossing) {
+				if pausedSince.IsZero() {
+					pausedSince = now
+					aw.KeyUpSync(KEY_W, 100)
+					log.Info().Str("screen", transition).AnErr("err", err).Msg("Navigation paused")
+				}
+				if now.Sub(pausedSince).Milliseconds() > param.TransitionTimeout {
+					log.Error().Str("screen", transition).AnErr("err", err).Msg("Transition timeout")
+					return fail(MOVE_FAILURE_TRANSITION_TIMEOUT)
+				}
+				if transition != "" {
+					continue
+				}
+			} else if !pausedSince.IsZero() {
+				paused := now.Sub(pausedSince)
+				lastArrivalTime = lastArrivalTime.Add(paused)
+				prevLocationTime = prevLocationTime.Add(paused)
+				if !lastRotationAdjustTime.IsZero() {
+					lastRotationAdjustTime = lastRotationAdjustTime.Add(paused)
+				}
+				pausedSince = time.Time{}
+				// The player may have been moved arbitrarily in the meantime
+				if motion != nil {
+					motion.reset()
+				}
+				if pursuit != nil {
+					pursuit.reset()
+				}
+				log.Info().Int64("pausedMs", paused.Milliseconds()).Msg("Navigation resumed")
+			}
+
+			// Check arrival timeout, which plain inference failures count towards
 			deltaArrivalMs := now.Sub(lastArrivalTime).Milliseconds()
-			if deltaArrivalMs > param.ArrivalTimeout {
-				log.Error().Msg("Arrival timeout, stopping task")
-				doEmergencyStop(aw, param.NoPrint)
-				return false
+			if pausedSince.IsZero() && deltaArrivalMs > param.ArrivalTimeout {
+				log.Error().Msg("Arrival timeout")
+				return fail(MOVE_FAILURE_ARRIVAL_TIMEOUT)
 			}
 
-			// Run inference to get current location and rotation
-			result, err := doInfer(ctx, ctrl, param)
 			if err != nil {
-				log.Error().Err(err).Msg("Inference failed during navigation")
+				log.Debug().Err(err).Msg("Inference failed during navigation")
 				aw.KeyUpSync(KEY_W, 100)
+				if img == nil {
+					continue
+				}
+
+				// The location may be lost because the player is on another map
+				if misses++; misses >= MAP_CHANGE_CHECK_MISSES {
+					misses = 0
+					if res, err := doInferImage(ctx, img, DEFAULT_INFERENCE_PARAM.MapNameRegex); err == nil &&
+						!isSameBaseMap(res.BaseMap, mapName) && !isSameBaseMap(res.BaseMap, prevMapName) {
+						if j := param.findMapSwitch(i, res.BaseMap); j >= 0 {
+							log.Info().Str("map", res.BaseMap).Int("index", j).Msg("Map switched, skipping to the target point on the new map")
+							i = j - 1
+							continue targets
+						}
+						log.Error().Str("map", res.BaseMap).Str("expected", mapName).Msg("Map changed unexpectedly")
+						return fail(MOVE_FAILURE_MAP_CHANGED)
+					}
+				}
 				continue
 			}
+			misses = 0
 
-			curX, curY := result.X, result.Y
+			// Keep walking ahead until the player reaches the new map
+			if crossing && !isSameBaseMap(result.BaseMap, mapName) {
+				log.Debug().Str("map", result.MapName).Msg("Crossing to the new map")
+				aw.KeyDownSync(KEY_W, 100)
+				continue
+			}
+
+			curX, curY := calcFramePosition(result, mapName)
 			rot := result.Rot
 
+			// Smooth the location and reject impossible jumps
+			rawX, rawY := curX, curY
+			if motion != nil {
+				est, accepted := motion.update(curX, curY, result.LocConf, now)
+				if !accepted {
+					// The player was not observed anywhere this time, so neither arrival nor stuck
+					// is evaluated, and the next fix is waited for at the last accepted location
+					log.Debug().Int("x", curX).Int("y", curY).Float64("conf", result.LocConf).Msg("Location rejected by motion filter")
+					if lastLocation != nil {
+						param.trace.add(mapName, lastLocation[0], lastLocation[1], rawX, rawY, true)
+					}
+					continue
+				}
+				curX, curY = int(math.Round(est.X)), int(math.Round(est.Y))
+				log.Debug().Float64("vx", est.VX).Float64("vy", est.VY).Bool("moving", est.Moving).Int("heading", est.Heading).Msg("Motion estimated")
+			}
+			lastLocation = &[2]int{curX, curY}
+			param.trace.add(mapName, curX, curY, rawX, rawY, false)
+
+			// Check tier switching
+			if prevTier != nil && *prevTier != result.Tier {
+				log.Info().Str("from", *prevTier).Str("to", result.Tier).Msg("Tier switched during navigation")
+			}
+			prevTier = &result.Tier
+
 			// Check Stuck
 			if prevLocation != nil && prevLocation[0] == curX && prevLocation[1] == curY {
 				deltaLocationMs := now.Sub(prevLocationTime).Milliseconds()
 				if deltaLocationMs > param.StuckTimeout {
-					log.Error().Msg("Stuck for too long, stopping task")
-					doEmergencyStop(aw, param.NoPrint)
-					return false
+					log.Error().Msg("Stuck for too long")
+					return fail(MOVE_FAILURE_STUCK_TIMEOUT)
 				}
 				if deltaLocationMs > param.StuckThreshold {
-					log.Info().Msg("Stuck detected, jumping...")
-					aw.KeyTypeSync(KEY_SPACE, 100)
+					maneuver := stuckRecovery[stuckStep%len(stuckRecovery)]
+					log.Info().Str("maneuver", maneuver).Int("step", stuckStep).Msg("Stuck detected, recovering...")
+					doStuckManeuver(aw, param, maneuver)
+					stuckStep++
+					if pursuit != nil {
+						pursuit.reset()
+					}
 				}
 			} else {
+				stuckStep = 0
 				prevLocation = &[2]int{curX, curY}
 				prevLocationTime = now
 			}
 
 			// Check arrival
 			dist := math.Hypot(float64(curX-targetX), float64(curY-targetY))
-			if dist < param.ArrivalThreshold {
+			if dist < arrivalThreshold {
 				log.Info().Int("x", curX).Int("y", curY).Int("index", i).Msg("Target point reached")
 				break
 			}
+			// In pursuit mode, intermediate points are passed through once within the lookahead distance
+			if pursuit != nil && i < len(param.Path)-1 && target.isPassable() && param.Path[i+1].MapName == "" && dist < param.Lookahead {
+				log.Info().Int("x", curX).Int("y", curY).Int("index", i).Msg("Target point passed")
+				passed = true
+				break
+			}
 
 			log.Debug().Int("x", curX).Int("y", curY).Float64("dist", dist).Msg("Navigating to target")
 
 			// Calculate & adjust rotation
-			targetRot := calcTargetRotation(curX, curY, targetX, targetY)
+			aimX, aimY := targetX, targetY
+			if pursuit != nil {
+				aimX, aimY = calcLookaheadPoint(param.Path, i, fromX, fromY, curX, curY, param.Lookahead)
+			}
+			targetRot := calcTargetRotation(curX, curY, aimX, aimY)
 			deltaRot := calcDeltaRotation(rot, targetRot)
 
-			// Check rotation and adjust if needed
+			// Check rotation timeout
 			if math.Abs(float64(deltaRot)) > param.RotationLowerThreshold {
 				if lastRotationAdjustTime.IsZero() {
 					lastRotationAdjustTime = now
 				}
 				deltaRotationAdjustMs := now.Sub(lastRotationAdjustTime).Milliseconds()
 				if deltaRotationAdjustMs > param.RotationTimeout {
-					log.Error().Msg("Rotation adjustment timeout, stopping task")
-					doEmergencyStop(aw, param.NoPrint)
-					return false
+					log.Error().Msg("Rotation adjustment timeout")
+					return fail(MOVE_FAILURE_ROTATION_TIMEOUT)
 				}
+			}
+
+			if pursuit != nil {
+				// Steer continuously towards the lookahead point
+				pursuit.steer(aw, rot, deltaRot, now)
+				if math.Abs(float64(deltaRot)) <= param.RotationLowerThreshold {
+					if dist > param.SprintThreshold && target.Action != WAYPOINT_SPRINT_OFF {
+						aw.KeyTypeSync(KEY_SHIFT, 100)
+					}
+					lastRotationAdjustTime = time.Time{} // Reset
+				}
+				continue
+			}
 
+			// Check rotation and adjust if needed
+			if math.Abs(float64(deltaRot)) > param.RotationLowerThreshold {
 				log.Debug().Int("cur", rot).Int("target", targetRot).Int("delta", deltaRot).Msg("Adjusting rotation")
 
 				if math.Abs(float64(deltaRot)) > param.RotationUpperThreshold {
@@ -187,7 +476,7 @@ func (a *MapTrackerMove) Run(ctx *maa.Context, arg *maa.CustomActionArg) bool {
 				}
 			} else {
 				aw.KeyDownSync(KEY_W, 100)
-				if dist > param.SprintThreshold {
+				if dist > param.SprintThreshold && target.Action != WAYPOINT_SPRINT_OFF {
 					// Sprint if target is far enough
 					aw.KeyTypeSync(KEY_SHIFT, 100)
 				}
@@ -196,18 +485,21 @@ func (a *MapTrackerMove) Run(ctx *maa.Context, arg *maa.CustomActionArg) bool {
 		}
 
 		// End of loop, one target reached
-		aw.KeyUpSync(KEY_W, 100)
-	}
+		if !passed {
+			aw.KeyUpSync(KEY_W, 100)
+		}
 
-	// Show finished UI summary
-	if !param.NoPrint {
-		maafocus.NodeActionStarting(
-			aw.ctx,
-			fmt.Sprintf(navigationFinishedHTML, len(param.Path)),
-		)
+		if err := doWaypointAction(ctx, aw, &target); err != nil {
+			log.Error().Err(err).Int("index", i).Str("action", target.Action).Msg("Waypoint action failed")
+			return fail(MOVE_FAILURE_ACTION)
+		}
+		if motion != nil && target.Action == WAYPOINT_RUN_NODE {
+			// The pipeline node may move the player arbitrarily
+			motion.reset()
+		}
 	}
 
-	return true
+	return nil
 }
 
 func (a *MapTrackerMove) parseParam(paramStr string) (*MapTrackerMoveParam, error) {
@@ -225,66 +517,324 @@ func (a *MapTrackerMove) parseParam(paramStr string) (*MapTrackerMoveParam, erro
 		return nil, fmt.Errorf("path is required in parameters, got empty")
 	}
 
-	// Validate parameters and set defaults
+	if err := param.normalize(); err != nil {
+		return nil, err
+	}
+	return &param, nil
+}
+
+// normalize validates the optional parameters and fills in their defaults
+func (param *MapTrackerMoveParam) normalize() error {
 	if param.ArrivalThreshold < 0 {
-		return nil, fmt.Errorf("arrival_threshold must be non-negative")
+		return fmt.Errorf("arrival_threshold must be non-negative")
 	} else if param.ArrivalThreshold == 0 {
 		param.ArrivalThreshold = DEFAULT_MOVING_PARAM.ArrivalThreshold
 	}
 
 	if param.ArrivalTimeout < 0 {
-		return nil, fmt.Errorf("arrival_timeout must be non-negative")
+		return fmt.Errorf("arrival_timeout must be non-negative")
 	} else if param.ArrivalTimeout == 0 {
 		param.ArrivalTimeout = DEFAULT_MOVING_PARAM.ArrivalTimeout
 	}
 
 	if param.RotationLowerThreshold < 0 {
-		return nil, fmt.Errorf("rotation_lower_threshold must be non-negative")
+		return fmt.Errorf("rotation_lower_threshold must be non-negative")
 	} else if param.RotationLowerThreshold > 180 {
-		return nil, fmt.Errorf("rotation_lower_threshold must be between 0 and 180 degrees")
+		return fmt.Errorf("rotation_lower_threshold must be between 0 and 180 degrees")
 	} else if param.RotationLowerThreshold == 0 {
 		param.RotationLowerThreshold = DEFAULT_MOVING_PARAM.RotationLowerThreshold
 	}
 
 	if param.RotationUpperThreshold < 0 {
-		return nil, fmt.Errorf("rotation_upper_threshold must be non-negative")
+		return fmt.Errorf("rotation_upper_threshold must be non-negative")
 	} else if param.RotationUpperThreshold > 180 {
-		return nil, fmt.Errorf("rotation_upper_threshold must be between 0 and 180 degrees")
+		return fmt.Errorf("rotation_upper_threshold must be between 0 and 180 degrees")
 	} else if param.RotationUpperThreshold == 0 {
 		param.RotationUpperThreshold = DEFAULT_MOVING_PARAM.RotationUpperThreshold
 	}
 
 	if param.RotationSpeed < 0 {
-		return nil, fmt.Errorf("rotation_speed must be non-negative")
+		return fmt.Errorf("rotation_speed must be non-negative")
 	} else if param.RotationSpeed == 0 {
 		param.RotationSpeed = DEFAULT_MOVING_PARAM.RotationSpeed
 	}
 
 	if param.RotationTimeout < 0 {
-		return nil, fmt.Errorf("rotation_timeout must be non-negative")
+		return fmt.Errorf("rotation_timeout must be non-negative")
 	} else if param.RotationTimeout == 0 {
 		param.RotationTimeout = DEFAULT_MOVING_PARAM.RotationTimeout
 	}
 
 	if param.SprintThreshold < 0 {
-		return nil, fmt.Errorf("sprint_threshold must be non-negative")
+		return fmt.Errorf("sprint_threshold must be non-negative")
 	} else if param.SprintThreshold == 0 {
 		param.SprintThreshold = DEFAULT_MOVING_PARAM.SprintThreshold
 	}
 
 	if param.StuckThreshold < 0 {
-		return nil, fmt.Errorf("stuck_threshold must be non-negative")
+		return fmt.Errorf("stuck_threshold must be non-negative")
 	} else if param.StuckThreshold == 0 {
 		param.StuckThreshold = DEFAULT_MOVING_PARAM.StuckThreshold
 	}
 
 	if param.StuckTimeout < 0 {
-		return nil, fmt.Errorf("stuck_timeout must be non-negative")
+		return fmt.Errorf("stuck_timeout must be non-negative")
 	} else if param.StuckTimeout == 0 {
 		param.StuckTimeout = DEFAULT_MOVING_PARAM.StuckTimeout
 	}
 
-	return &param, nil
+	if len(param.StuckRecovery) == 0 {
+		param.StuckRecovery = DEFAULT_MOVING_PARAM.StuckRecovery
+	}
+	if err := validateStuckRecovery(param.StuckRecovery); err != nil {
+		return fmt.Errorf("invalid stuck_recovery: %w", err)
+	}
+	for i, w := range param.Path {
+		if err := validateStuckRecovery(w.StuckRecovery); err != nil {
+			return fmt.Errorf("invalid stuck_recovery of path point %d: %w", i, err)
+		}
+		if w.Tolerance < 0 {
+			return fmt.Errorf("tolerance of path point %d must be non-negative", i)
+		}
+		switch w.Action {
+		case "", WAYPOINT_INTERACT, WAYPOINT_WAIT_FREEZE, WAYPOINT_SPRINT_OFF, WAYPOINT_JUMP:
+		case WAYPOINT_RUN_NODE:
+			if w.Node == "" {
+				return fmt.Errorf("node is required for action %q of path point %d", w.Action, i)
+			}
+		default:
+			return fmt.Errorf("unknown action %q of path point %d", w.Action, i)
+		}
+	}
+
+	switch param.Recovery {
+	case "":
+		param.Recovery = DEFAULT_MOVING_PARAM.Recovery
+	case RECOVERY_NONE, RECOVERY_RETRY, RECOVERY_BACKOFF, RECOVERY_REPLAN:
+	case RECOVERY_TELEPORT:
+		if param.TeleportNode == "" {
+			return fmt.Errorf("teleport_node is required for recovery %q", param.Recovery)
+		}
+	default:
+		return fmt.Errorf("unknown recovery strategy %q", param.Recovery)
+	}
+
+	if param.MaxRetries < 0 {
+		return fmt.Errorf("max_retries must be non-negative")
+	} else if param.MaxRetries == 0 {
+		param.MaxRetries = DEFAULT_MOVING_PARAM.MaxRetries
+	}
+
+	switch param.Steering {
+	case "":
+		param.Steering = DEFAULT_MOVING_PARAM.Steering
+	case STEERING_STEP, STEERING_PURSUIT:
+	default:
+		return fmt.Errorf("steering must be %q or %q, got %q", STEERING_STEP, STEERING_PURSUIT, param.Steering)
+	}
+
+	if param.Lookahead < 0 {
+		return fmt.Errorf("lookahead must be non-negative")
+	} else if param.Lookahead == 0 {
+		param.Lookahead = DEFAULT_MOVING_PARAM.Lookahead
+	}
+
+	if param.MaxSpeed < 0 {
+		return fmt.Errorf("max_speed must be non-negative")
+	} else if param.MaxSpeed == 0 {
+		param.MaxSpeed = DEFAULT_MOVING_PARAM.MaxSpeed
+	}
+
+	if param.TransitionTimeout < 0 {
+		return fmt.Errorf("transition_timeout must be non-negative")
+	} else if param.TransitionTimeout == 0 {
+		param.TransitionTimeout = DEFAULT_MOVING_PARAM.TransitionTimeout
+	}
+
+	switch param.OnFailure {
+	case "":
+		param.OnFailure = DEFAULT_MOVING_PARAM.OnFailure
+	case ON_FAILURE_STOP, ON_FAILURE_ERROR:
+	default:
+		return fmt.Errorf("on_failure must be %q or %q, got %q", ON_FAILURE_STOP, ON_FAILURE_ERROR, param.OnFailure)
+	}
+
+	return nil
+}
+
+// doRecover applies the recovery strategy of param to the given failure.
+// Returns the index of the target point to resume navigation from.
+func doRecover(ctx *maa.Context, aw *ActionWrapper, param *MapTrackerMoveParam, failure *MoveFailure) (int, error) {
+	switch param.Recovery {
+	case RECOVERY_RETRY:
+		return failure.Index, nil
+
+	case RECOVERY_BACKOFF:
+		// Walk back to the previous target point, which is known to be reachable,
+		// without repeating its action
+		if failure.Index == 0 {
+			return 0, nil
+		}
+		prev := param.Path[failure.Index-1]
+		if f := moveDetour(ctx, aw, param, param.waypointMap(failure.Index-1), []Waypoint{{X: prev.X, Y: prev.Y}}); f != nil {
+			return 0, fmt.Errorf("failed to back off to target point %d: %s", failure.Index-1, f.Reason)
+		}
+		return failure.Index, nil
+
+	case RECOVERY_REPLAN:
+		// Take a detour to the failed target point through the navigation graph.
+		// The graph is in base map coordinates, so the detour is planned and walked on the base map.
+		if !failure.Located {
+			return 0, fmt.Errorf("current location is unknown")
+		}
+		baseName, _ := parseTierName(failure.MapName)
+		offsetX, offsetY, err := loadTierOffset(failure.MapName)
+		if err != nil {
+			return 0, err
+		}
+		graph, err := loadNavGraph(baseName)
+		if err != nil {
+			return 0, err
+		}
+		start, _ := graph.NearestNode(failure.X+offsetX, failure.Y+offsetY)
+		goal, _ := graph.NearestNode(failure.Target[0]+offsetX, failure.Target[1]+offsetY)
+		steps, err := graph.Plan(start, goal)
+		if err != nil {
+			return 0, err
+		}
+		detour := make([]Waypoint, 0, len(steps)+1)
+		for _, step := range steps {
+			if step.Edge != nil && step.Edge.Node != "" {
+				return 0, fmt.Errorf("detour requires pipeline node %s", step.Edge.Node)
+			}
+			detour = append(detour, Waypoint{X: step.Node.X, Y: step.Node.Y})
+		}
+		target := param.Path[failure.Index]
+		target.MapName = ""
+		target.X, target.Y = target.X+offsetX, target.Y+offsetY
+		detour = append(detour, target)
+		if f := moveDetour(ctx, aw, param, baseName, detour); f != nil {
+			return 0, fmt.Errorf("failed to take detour: %s", f.Reason)
+		}
+		return failure.Index + 1, nil
+
+	case RECOVERY_TELEPORT:
+		// The path is expected to be reachable from the teleport point
+		if err := runPipelineNode(ctx, param.TeleportNode); err != nil {
+			return 0, err
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("unknown recovery strategy %q", param.Recovery)
+}
+
+// moveDetour walks along the given path on the given map with the movement parameters of param
+func moveDetour(ctx *maa.Context, aw *ActionWrapper, param *MapTrackerMoveParam, mapName string, path []Waypoint) *MoveFailure {
+	detourParam := *param
+	detourParam.MapName = mapName
+	detourParam.Path = path
+	return moveAlong(ctx, aw, &detourParam, 0)
+}
+
+// waypointMap returns the map of the i-th target point, which is the map_name of
+// the last point up to it that declares one, or the map_name of param otherwise
+func (param *MapTrackerMoveParam) waypointMap(i int) string {
+	for ; i >= 0; i-- {
+		if param.Path[i].MapName != "" {
+			return param.Path[i].MapName
+		}
+	}
+	return param.MapName
+}
+
+// findMapSwitch returns the index of the first target point from the given index
+// on the given base map, or -1 if the rest of the path never switches to it
+func (param *MapTrackerMoveParam) findMapSwitch(from int, baseName string) int {
+	for j := from; j < len(param.Path); j++ {
+		if isSameBaseMap(param.waypointMap(j), baseName) {
+			return j
+		}
+	}
+	return -1
+}
+
+// doFailureExit ends a failed navigation according to param.OnFailure
+func doFailureExit(aw *ActionWrapper, param *MapTrackerMoveParam, failure *MoveFailure) {
+	if param.OnFailure == ON_FAILURE_STOP {
+		doEmergencyStop(aw, param.NoPrint)
+		return
+	}
+	log.Warn().Str("reason", failure.Reason).Int("index", failure.Index).Msg("Navigation failed, leaving to on_error")
+	if !param.NoPrint {
+		maafocus.NodeActionStarting(
+			aw.ctx,
+			fmt.Sprintf(navigationFailedHTML, failure.Reason, failure.Index+1, len(param.Path)),
+		)
+	}
+	aw.KeyUpSync(KEY_W, 100)
+}
+
+// doWaypointAction performs the action of a reached waypoint
+func doWaypointAction(ctx *maa.Context, aw *ActionWrapper, w *Waypoint) error {
+	switch w.Action {
+	case WAYPOINT_INTERACT:
+		aw.KeyTypeSync(KEY_F, WAYPOINT_ACTION_DELAY_MS)
+	case WAYPOINT_JUMP:
+		aw.KeyTypeSync(KEY_SPACE, WAYPOINT_ACTION_DELAY_MS)
+	case WAYPOINT_WAIT_FREEZE:
+		if !ctx.WaitFreezes(time.Duration(WAYPOINT_FREEZE_MS)*time.Millisecond, nil) {
+			return fmt.Errorf("screen did not freeze")
+		}
+	case WAYPOINT_RUN_NODE:
+		log.Info().Str("node", w.Node).Msg("Running pipeline node at waypoint")
+		return runPipelineNode(ctx, w.Node)
+	}
+	return nil
+}
+
+// validateStuckRecovery checks that all maneuvers of a stuck recovery sequence are known
+func validateStuckRecovery(seq []string) error {
+	for _, m := range seq {
+		switch m {
+		case STUCK_JUMP, STUCK_JUMP_FORWARD, STUCK_STRAFE_LEFT, STUCK_STRAFE_RIGHT,
+			STUCK_BACKWARD, STUCK_ROTATE_LEFT, STUCK_ROTATE_RIGHT:
+		default:
+			return fmt.Errorf("unknown maneuver %q", m)
+		}
+	}
+	return nil
+}
+
+// doStuckManeuver performs one stuck recovery maneuver.
+// The movement loop will press KEY_W and steer towards the target again afterwards.
+func doStuckManeuver(aw *ActionWrapper, param *MapTrackerMoveParam, maneuver string) {
+	switch maneuver {
+	case STUCK_JUMP:
+		aw.KeyTypeSync(KEY_SPACE, 100)
+	case STUCK_JUMP_FORWARD:
+		aw.KeyDownSync(KEY_W, 0)
+		aw.KeyTypeSync(KEY_SPACE, STUCK_MANEUVER_MS)
+	case STUCK_STRAFE_LEFT, STUCK_STRAFE_RIGHT:
+		key := KEY_A
+		if maneuver == STUCK_STRAFE_RIGHT {
+			key = KEY_D
+		}
+		aw.KeyUpSync(KEY_W, 0)
+		aw.KeyDownSync(key, STUCK_MANEUVER_MS)
+		aw.KeyUpSync(key, 0)
+	case STUCK_BACKWARD:
+		aw.KeyUpSync(KEY_W, 0)
+		aw.KeyDownSync(KEY_S, STUCK_MANEUVER_MS)
+		aw.KeyUpSync(KEY_S, 0)
+	case STUCK_ROTATE_LEFT, STUCK_ROTATE_RIGHT:
+		angle := -STUCK_ROTATE_ANGLE
+		if maneuver == STUCK_ROTATE_RIGHT {
+			angle = STUCK_ROTATE_ANGLE
+		}
+		aw.KeyUpSync(KEY_W, 0)
+		aw.RotateCamera(int(float64(angle)*param.RotationSpeed), 100, 100)
+		aw.KeyDownSync(KEY_W, STUCK_MANEUVER_MS)
+	}
 }
 
 func doEmergencyStop(aw *ActionWrapper, noPrint bool) {
@@ -297,7 +847,21 @@ func doEmergencyStop(aw *ActionWrapper, noPrint bool) {
 }
 
 func doInfer(ctx *maa.Context, ctrl *maa.Controller, param *MapTrackerMoveParam) (*MapTrackerInferResult, error) {
-	// Capture Screen
+	// Match the tier layers as well if a base map is given
+	return doInferRegex(ctx, ctrl, calcMapNamesRegex([]string{param.MapName}))
+}
+
+// doInferRegex captures the screen and runs MapTrackerInfer in tracking mode on maps matching the regex
+func doInferRegex(ctx *maa.Context, ctrl *maa.Controller, mapNameRegex string) (*MapTrackerInferResult, error) {
+	img, err := captureScreen(ctrl)
+	if err != nil {
+		return nil, err
+	}
+	return doInferImage(ctx, img, mapNameRegex)
+}
+
+// captureScreen captures the screen and returns the image
+func captureScreen(ctrl *maa.Controller) (image.Image, error) {
 	ctrl.PostScreencap().Wait()
 	img, err := ctrl.CacheImage()
 	if err != nil {
@@ -308,7 +872,11 @@ func doInfer(ctx *maa.Context, ctrl *maa.Controller, param *MapTrackerMoveParam)
 		log.Error().Msg("Cached image is nil")
 		return nil, fmt.Errorf("cached image is nil")
 	}
+	return img, nil
+}
 
+// doInferImage runs MapTrackerInfer in tracking mode on the captured image and maps matching the regex
+func doInferImage(ctx *maa.Context, img image.Image, mapNameRegex string) (*MapTrackerInferResult, error) {
 	// Run recognition
 	nodeName := "MapTrackerMove_Infer"
 	config := map[string]any{
@@ -316,9 +884,11 @@ func doInfer(ctx *maa.Context, ctrl *maa.Controller, param *MapTrackerMoveParam)
 			"recognition":        "Custom",
 			"custom_recognition": "MapTrackerInfer",
 			"custom_recognition_param": map[string]any{
-				"map_name_regex": "^" + regexp.QuoteMeta(param.MapName) + "$",
+				"map_name_regex": mapNameRegex,
 				"precision":      DEFAULT_INFERENCE_PARAM_FOR_MOVE.Precision,
 				"threshold":      DEFAULT_INFERENCE_PARAM_FOR_MOVE.Threshold,
+				"track":          DEFAULT_INFERENCE_PARAM_FOR_MOVE.Track,
+				"backend":        DEFAULT_INFERENCE_PARAM_FOR_MOVE.Backend,
 			},
 		},
 	}
@@ -334,19 +904,9 @@ func doInfer(ctx *maa.Context, ctrl *maa.Controller, param *MapTrackerMoveParam)
 	}
 
 	// Extract result
-	var result MapTrackerInferResult
-	var wrapped struct {
-		Best struct {
-			Detail json.RawMessage `json:"detail"`
-		} `json:"best"`
-	}
-
-	if err := json.Unmarshal([]byte(res.DetailJson), &wrapped); err != nil {
-		log.Error().Err(err).Msg("Failed to unmarshal wrapped result")
-		return nil, err
-	}
-	if err := json.Unmarshal(wrapped.Best.Detail, &result); err != nil {
-		log.Error().Err(err).Msg("Failed to unmarshal MapTrackerInferResult")
+	result, err := parseInferDetail(res.DetailJson)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse inference result")
 		return nil, err
 	}
 	if result.MapName == "None" {
@@ -354,7 +914,7 @@ func doInfer(ctx *maa.Context, ctrl *maa.Controller, param *MapTrackerMoveParam)
 		return nil, fmt.Errorf("map not recognized in inference result")
 	}
 
-	return &result, nil
+	return result, nil
 }
 
 // calcTargetRotation calculates the angle from (fromX, fromY) to (toX, toY).
@@ -0,0 +1,101 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+
+	"github.com/MaaXYZ/maa-framework-go/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// MoveFailure is the structured outcome of a failed navigation
+type MoveFailure struct {
+	// Reason is the failure reason code, e.g. "arrival_timeout", "rotation_timeout" or "stuck_timeout".
+	Reason string `json:"reason"`
+	// MapName is the map of the target point that could not be reached.
+	MapName string `json:"mapName"`
+	// Located tells whether X and Y hold the last known location.
+	Located bool `json:"located"`
+	// X and Y are the last known location of the player, in the coordinates of MapName.
+	X int `json:"x"`
+	Y int `json:"y"`
+	// Moving tells whether the player was moving at the last known location, and Heading is
+	// the direction of that movement (0-359 degrees, clockwise from up), as smoothed by the motion filter.
+	Moving  bool `json:"moving"`
+	Heading int  `json:"heading"`
+	// Index is the index of the target point that could not be reached.
+	Index int `json:"index"`
+	// Target is the target point that could not be reached.
+	Target [2]int `json:"target"`
+	// Retries is the number of recovery attempts made before this failure.
+	Retries int `json:"retries"`
+}
+
+var (
+	moveFailureMu sync.Mutex
+	moveFailures  = make(map[maa.Tasker]MoveFailure)
+)
+
+func setMoveFailure(tasker maa.Tasker, failure *MoveFailure) {
+	moveFailureMu.Lock()
+	defer moveFailureMu.Unlock()
+	moveFailures[tasker] = *failure
+}
+
+func clearMoveFailure(tasker maa.Tasker) {
+	moveFailureMu.Lock()
+	defer moveFailureMu.Unlock()
+	delete(moveFailures, tasker)
+}
+
+func getMoveFailure(tasker maa.Tasker) *MoveFailure {
+	moveFailureMu.Lock()
+	defer moveFailureMu.Unlock()
+	if f, ok := moveFailures[tasker]; ok {
+		return &f
+	}
+	return nil
+}
+
+type MapTrackerMoveFailure struct{}
+
+// MapTrackerMoveFailureParam represents the custom_recognition_param for MapTrackerMoveFailure
+type MapTrackerMoveFailureParam struct {
+	// Reasons filters the failure reasons to hit on. Any reason is accepted if empty.
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+var _ maa.CustomRecognitionRunner = &MapTrackerMoveFailure{}
+
+// Run implements maa.CustomRecognitionRunner.
+// It hits if the last navigation of the current tasker failed, with the failure as detail.
+func (r *MapTrackerMoveFailure) Run(ctx *maa.Context, arg *maa.CustomRecognitionArg) (*maa.CustomRecognitionResult, bool) {
+	var param MapTrackerMoveFailureParam
+	if arg.CustomRecognitionParam != "" {
+		if err := json.Unmarshal([]byte(arg.CustomRecognitionParam), &param); err != nil {
+			log.Error().Err(err).Msg("Failed to parse parameters for MapTrackerMoveFailure")
+			return nil, false
+		}
+	}
+
+	failure := getMoveFailure(*ctx.GetTasker())
+	if failure == nil {
+		return nil, false
+	}
+	if len(param.Reasons) > 0 && !slices.Contains(param.Reasons, failure.Reason) {
+		return nil, false
+	}
+
+	detail, err := json.Marshal(failure)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal move failure")
+		return nil, false
+	}
+	log.Info().Str("reason", failure.Reason).Int("index", failure.Index).Msg("Move failure recognized")
+	return &maa.CustomRecognitionResult{
+		Box:    arg.Roi,
+		Detail: string(detail),
+	}, true
+}
@@ -0,0 +1,254 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// NavNode is a walkable node of a navigation graph, in base map coordinates
+type NavNode struct {
+	// ID is the unique identifier of the node (required).
+	ID string `json:"id"`
+	// X and Y are the coordinates of the node on the base map (required).
+	X int `json:"x"`
+	Y int `json:"y"`
+	// Name is an optional human-readable destination name.
+	Name string `json:"name,omitempty"`
+}
+
+// NavEdge is a connection between two navigation nodes
+type NavEdge struct {
+	// From and To are the node IDs of the edge (required).
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Type is the traversal type, one of "walk" (default), "jump", "zipline" and "teleport".
+	Type string `json:"type,omitempty"`
+	// Cost overrides the default traversal cost of the edge if positive.
+	Cost float64 `json:"cost,omitempty"`
+	// OneWay disables the reverse direction of the edge.
+	OneWay bool `json:"one_way,omitempty"`
+	// Node is the pipeline node to run to traverse a non-walking edge, required for "zipline" and "teleport".
+	Node string `json:"node,omitempty"`
+}
+
+// NavGraph is the navigation graph resource of a base map
+type NavGraph struct {
+	Nodes []NavNode `json:"nodes"`
+	Edges []NavEdge `json:"edges"`
+
+	nodeIndex map[string]int
+	adjacency [][]navArc
+	// hFactor scales the straight-line distance into an admissible A* heuristic
+	hFactor float64
+}
+
+// navArc is a directed edge in the adjacency list
+type navArc struct {
+	to   int
+	cost float64
+	edge *NavEdge
+}
+
+// NavStep is one step of a planned route, arriving at Node via Edge
+// (Edge is nil for the first step)
+type NavStep struct {
+	Node *NavNode
+	Edge *NavEdge
+}
+
+// navEdgeCostParams holds the default (distance factor, fixed cost) of each edge type
+var navEdgeCostParams = map[string][2]float64{
+	"walk":     {1.0, 0.0},
+	"jump":     {1.0, 20.0},
+	"zipline":  {0.5, 30.0},
+	"teleport": {0.0, 100.0},
+}
+
+// loadNavGraph loads and validates the navigation graph of the given base map
+func loadNavGraph(mapName string) (*NavGraph, error) {
+	path := findResource(filepath.Join(NAV_DIR, mapName+".json"))
+	if path == "" {
+		return nil, fmt.Errorf("navigation graph for map %s not found", mapName)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read navigation graph: %w", err)
+	}
+	var g NavGraph
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal navigation graph: %w", err)
+	}
+	if err := g.build(); err != nil {
+		return nil, fmt.Errorf("invalid navigation graph %s: %w", path, err)
+	}
+	return &g, nil
+}
+
+// build validates the graph and builds the adjacency list
+func (g *NavGraph) build() error {
+	if len(g.Nodes) == 0 {
+		return fmt.Errorf("no nodes")
+	}
+	g.nodeIndex = make(map[string]int, len(g.Nodes))
+	for idx, n := range g.Nodes {
+		if n.ID == "" {
+			return fmt.Errorf("node at index %d has empty id", idx)
+		}
+		if _, exists := g.nodeIndex[n.ID]; exists {
+			return fmt.Errorf("duplicate node id %q", n.ID)
+		}
+		g.nodeIndex[n.ID] = idx
+	}
+
+	g.adjacency = make([][]navArc, len(g.Nodes))
+	g.hFactor = 1.0
+	for idx := range g.Edges {
+		e := &g.Edges[idx]
+		if e.Type == "" {
+			e.Type = "walk"
+		}
+		params, ok := navEdgeCostParams[e.Type]
+		if !ok {
+			return fmt.Errorf("edge %s->%s has unknown type %q", e.From, e.To, e.Type)
+		}
+		// Only walking and jumping are done by moving, the others need a pipeline node
+		if e.Type != "walk" && e.Type != "jump" && e.Node == "" {
+			return fmt.Errorf("edge %s->%s of type %q requires node", e.From, e.To, e.Type)
+		}
+		from, ok1 := g.nodeIndex[e.From]
+		to, ok2 := g.nodeIndex[e.To]
+		if !ok1 || !ok2 {
+			return fmt.Errorf("edge %s->%s refers to unknown node", e.From, e.To)
+		}
+
+		dist := g.distance(from, to)
+		cost := dist*params[0] + params[1]
+		if e.Cost > 0 {
+			cost = e.Cost
+		}
+		// Keep the heuristic admissible for edges cheaper than walking
+		if dist > 0 {
+			g.hFactor = min(g.hFactor, cost/dist)
+		}
+
+		g.adjacency[from] = append(g.adjacency[from], navArc{to, cost, e})
+		if !e.OneWay {
+			g.adjacency[to] = append(g.adjacency[to], navArc{from, cost, e})
+		}
+	}
+	return nil
+}
+
+func (g *NavGraph) distance(a, b int) float64 {
+	return math.Hypot(float64(g.Nodes[a].X-g.Nodes[b].X), float64(g.Nodes[a].Y-g.Nodes[b].Y))
+}
+
+// FindNode returns the node with the given ID or name, or nil if not found
+func (g *NavGraph) FindNode(key string) *NavNode {
+	if idx, ok := g.nodeIndex[key]; ok {
+		return &g.Nodes[idx]
+	}
+	for idx := range g.Nodes {
+		if g.Nodes[idx].Name == key {
+			return &g.Nodes[idx]
+		}
+	}
+	return nil
+}
+
+// NearestNode returns the node closest to (x, y) and its distance
+func (g *NavGraph) NearestNode(x, y int) (*NavNode, float64) {
+	best, bestDist := -1, math.Inf(1)
+	for idx, n := range g.Nodes {
+		d := math.Hypot(float64(n.X-x), float64(n.Y-y))
+		if d < bestDist {
+			best, bestDist = idx, d
+		}
+	}
+	return &g.Nodes[best], bestDist
+}
+
+// Plan finds the lowest-cost route between two nodes using A*.
+// Returns the steps from start to goal (inclusive), or an error if the goal is unreachable.
+func (g *NavGraph) Plan(start, goal *NavNode) ([]NavStep, error) {
+	s, t := g.nodeIndex[start.ID], g.nodeIndex[goal.ID]
+
+	cost := make([]float64, len(g.Nodes))
+	for idx := range cost {
+		cost[idx] = math.Inf(1)
+	}
+	prev := make([]*navArc, len(g.Nodes))
+	prevNode := make([]int, len(g.Nodes))
+	closed := make([]bool, len(g.Nodes))
+
+	cost[s] = 0
+	open := &navQueue{{node: s, f: g.distance(s, t) * g.hFactor}}
+	for open.Len() > 0 {
+		cur := heap.Pop(open).(navQueueItem).node
+		if closed[cur] {
+			continue
+		}
+		if cur == t {
+			break
+		}
+		closed[cur] = true
+		for idx := range g.adjacency[cur] {
+			arc := &g.adjacency[cur][idx]
+			if closed[arc.to] {
+				continue
+			}
+			c := cost[cur] + arc.cost
+			if c < cost[arc.to] {
+				cost[arc.to] = c
+				prev[arc.to] = arc
+				prevNode[arc.to] = cur
+				heap.Push(open, navQueueItem{arc.to, c + g.distance(arc.to, t)*g.hFactor})
+			}
+		}
+	}
+
+	if math.IsInf(cost[t], 1) {
+		return nil, fmt.Errorf("no route from node %s to node %s", start.ID, goal.ID)
+	}
+
+	// Walk back from the goal
+	steps := make([]NavStep, 0)
+	for n := t; ; n = prevNode[n] {
+		step := NavStep{Node: &g.Nodes[n]}
+		if prev[n] != nil {
+			step.Edge = prev[n].edge
+		}
+		steps = append(steps, step)
+		if n == s {
+			break
+		}
+	}
+	for a, b := 0, len(steps)-1; a < b; a, b = a+1, b-1 {
+		steps[a], steps[b] = steps[b], steps[a]
+	}
+	return steps, nil
+}
+
+// navQueue is a min-heap of A* open set items ordered by f score
+type navQueue []navQueueItem
+
+type navQueueItem struct {
+	node int
+	f    float64
+}
+
+func (q navQueue) Len() int           { return len(q) }
+func (q navQueue) Less(i, j int) bool { return q[i].f < q[j].f }
+func (q navQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *navQueue) Push(x any)        { *q = append(*q, x.(navQueueItem)) }
+func (q *navQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/MaaXYZ/maa-framework-go/v4"
+	"github.com/rs/zerolog/log"
+)
+
+type MapTrackerNavigate struct{}
+
+// MapTrackerNavigateParam represents the custom_action_param for MapTrackerNavigate.
+// It accepts all optional movement parameters of MapTrackerMoveParam, except for Path.
+type MapTrackerNavigateParam struct {
+	MapTrackerMoveParam
+	// Target is the destination [x, y] on the base map (either this or Destination is required).
+	Target *[2]int `json:"target,omitempty"`
+	// Destination is the ID or name of the destination node in the navigation graph.
+	Destination string `json:"destination,omitempty"`
+}
+
+var _ maa.CustomActionRunner = &MapTrackerNavigate{}
+
+// Run implements maa.CustomActionRunner
+func (a *MapTrackerNavigate) Run(ctx *maa.Context, arg *maa.CustomActionArg) bool {
+	param, err := a.parseParam(arg.CustomActionParam)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse parameters for MapTrackerNavigate")
+		return false
+	}
+
+	graph, err := loadNavGraph(param.MapName)
+	if err != nil {
+		log.Error().Err(err).Str("map", param.MapName).Msg("Failed to load navigation graph")
+		return false
+	}
+
+	// Resolve the goal node
+	var goal *NavNode
+	if param.Destination != "" {
+		if goal = graph.FindNode(param.Destination); goal == nil {
+			log.Error().Str("destination", param.Destination).Msg("Destination node not found in navigation graph")
+			return false
+		}
+	} else {
+		goal, _ = graph.NearestNode(param.Target[0], param.Target[1])
+	}
+
+	// Resolve the start node from the current location
+	ctrl := ctx.GetTasker().GetController()
+	res, err := doInfer(ctx, ctrl, &param.MapTrackerMoveParam)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to infer current location for navigation")
+		return false
+	}
+	curX, curY := calcFramePosition(res, param.MapName)
+	start, startDist := graph.NearestNode(curX, curY)
+
+	steps, err := graph.Plan(start, goal)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to plan route")
+		return false
+	}
+	log.Info().
+		Int("x", curX).
+		Int("y", curY).
+		Str("start", start.ID).
+		Float64("startDist", startDist).
+		Str("goal", goal.ID).
+		Int("steps", len(steps)).
+		Msg("Route planned")
+
+	return a.runRoute(ctx, param, steps)
+}
+
+// runRoute walks along the planned steps, splitting the route into walking legs
+// at edges that need a pipeline node to traverse (e.g. ziplines and teleports)
+func (a *MapTrackerNavigate) runRoute(ctx *maa.Context, param *MapTrackerNavigateParam, steps []NavStep) bool {
+	leg := make([]Waypoint, 0, len(steps)+1)
+	flush := func() bool {
+		if len(leg) == 0 {
+			return true
+		}
+		moveParam := param.MapTrackerMoveParam
+		moveParam.Path = leg
+		leg = make([]Waypoint, 0)
+		return doMove(ctx, &moveParam) == nil
+	}
+
+	for _, step := range steps {
+		if step.Edge != nil && step.Edge.Node != "" {
+			if !flush() {
+				return false
+			}
+			log.Info().Str("type", step.Edge.Type).Str("node", step.Edge.Node).Msg("Traversing edge by pipeline node")
+			if err := runPipelineNode(ctx, step.Edge.Node); err != nil {
+				log.Error().Err(err).Str("node", step.Edge.Node).Msg("Failed to traverse edge")
+				return false
+			}
+			continue
+		}
+		leg = append(leg, Waypoint{X: step.Node.X, Y: step.Node.Y})
+	}
+
+	// Finally walk from the goal node to the exact target
+	if param.Target != nil {
+		last := steps[len(steps)-1].Node
+		if last.X != param.Target[0] || last.Y != param.Target[1] {
+			leg = append(leg, Waypoint{X: param.Target[0], Y: param.Target[1]})
+		}
+	}
+	return flush()
+}
+
+func (a *MapTrackerNavigate) parseParam(paramStr string) (*MapTrackerNavigateParam, error) {
+	var param MapTrackerNavigateParam
+	if err := json.Unmarshal([]byte(paramStr), &param); err != nil {
+		return nil, fmt.Errorf("failed to parse parameters: %w", err)
+	}
+	if len(param.MapName) == 0 {
+		return nil, fmt.Errorf("map_name is required in parameters, got empty")
+	}
+	if isTierName(param.MapName) {
+		return nil, fmt.Errorf("map_name must be a base map, got tier map %s", param.MapName)
+	}
+	if len(param.Path) != 0 {
+		return nil, fmt.Errorf("path must not be set, it is planned from the navigation graph")
+	}
+	if (param.Target == nil) == (param.Destination == "") {
+		return nil, fmt.Errorf("exactly one of target and destination is required")
+	}
+	if err := param.normalize(); err != nil {
+		return nil, err
+	}
+	return &param, nil
+}
+
+// runPipelineNode runs a pipeline node as a sub task and waits for it to finish
+func runPipelineNode(ctx *maa.Context, node string) error {
+	detail, err := ctx.RunTask(node)
+	if err != nil {
+		return err
+	}
+	if detail == nil || !detail.Status.Success() {
+		return fmt.Errorf("pipeline node %s did not succeed", node)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"math/cmplx"
+	"sync"
+)
+
+// fftPlan holds the precomputed tables of a radix-2 FFT of size n,
+// and a pool of scratch buffers for 2D transforms of size n x n
+type fftPlan struct {
+	n   int
+	rev []int
+	tw  []complex128
+	buf sync.Pool
+}
+
+var fftPlans sync.Map
+
+// getFFTPlan returns the FFT plan of size n, which must be a power of two
+func getFFTPlan(n int) *fftPlan {
+	if p, ok := fftPlans.Load(n); ok {
+		return p.(*fftPlan)
+	}
+	logN := bits.TrailingZeros(uint(n))
+	p := &fftPlan{n: n, rev: make([]int, n), tw: make([]complex128, n/2)}
+	for k := range n {
+		p.rev[k] = int(bits.Reverse(uint(k)) >> (bits.UintSize - logN))
+	}
+	for k := range n / 2 {
+		p.tw[k] = cmplx.Rect(1, -2*math.Pi*float64(k)/float64(n))
+	}
+	p.buf.New = func() any {
+		return make([]complex128, 2*n*n)
+	}
+	actual, _ := fftPlans.LoadOrStore(n, p)
+	return actual.(*fftPlan)
+}
+
+// transform computes the in-place unnormalized FFT of a, or its inverse without the 1/n factor
+func (p *fftPlan) transform(a []complex128, inverse bool) {
+	n := p.n
+	for k, r := range p.rev {
+		if k < r {
+			a[k], a[r] = a[r], a[k]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		half, step := size/2, n/size
+		for start := 0; start < n; start += size {
+			for k := 0; k < half; k++ {
+				w := p.tw[k*step]
+				if inverse {
+					w = cmplx.Conj(w)
+				}
+				u, v := a[start+k], a[start+k+half]*w
+				a[start+k], a[start+k+half] = u+v, u-v
+			}
+		}
+	}
+}
+
+// transform2D computes the 2D FFT (or its unnormalized inverse) of the n x n matrix a in place.
+// The result is transposed, so a forward transform followed by an inverse one restores the layout,
+// and spectra of the same layout can be multiplied element-wise.
+func (p *fftPlan) transform2D(a []complex128, inverse bool) {
+	n := p.n
+	for pass := 0; pass < 2; pass++ {
+		for y := 0; y < n; y++ {
+			p.transform(a[y*n:(y+1)*n], inverse)
+		}
+		if pass == 0 {
+			for y := 0; y < n; y++ {
+				for x := y + 1; x < n; x++ {
+					a[y*n+x], a[x*n+y] = a[x*n+y], a[y*n+x]
+				}
+			}
+		}
+	}
+}
+
+// fftTileSize returns the FFT tile size for the search positions and the needle,
+// which covers the whole search if possible, and at least twice the needle size otherwise
+func fftTileSize(posW, posH, nW, nH int) int {
+	need := nextPow2(max(posW+nW-1, posH+nH-1))
+	return min(need, max(FFT_TILE_SIZE, nextPow2(2*max(nW, nH))))
+}
+
+func nextPow2(v int) int {
+	if v <= 1 {
+		return 1
+	}
+	return 1 << bits.Len(uint(v-1))
+}
+
+// estimateFFTCost estimates the cost of scoring all posW x posH positions by FFT,
+// in the same unit as a multiply-accumulate of the direct computation
+func estimateFFTCost(posW, posH, nW, nH int) float64 {
+	t := fftTileSize(posW, posH, nW, nH)
+	tiles := ((posW + t - nW) / (t - nW + 1)) * ((posH + t - nH) / (t - nH + 1))
+	// Three forward and one inverse 2D transforms of (t * t / 2 * log2(t)) butterflies each, per pass
+	butterflies := 4.0 * 2 * float64(t*t/2) * math.Log2(float64(t))
+	return float64(tiles) * butterflies * FFT_COST_FACTOR
+}
+
+// matchScoresFFT computes the NCC score of every top-left position (x, y) in [minX, maxX] x [minY, maxY]
+// by FFT-based cross-correlation, tile by tile (overlap-save).
+// The scores are the same as those of computeNCCFast, up to floating-point rounding.
+// Returns the scores in row-major order, with (maxX - minX + 1) columns.
+func matchScoresFFT(hRGBA *image.RGBA, hInt *IntegralImage, nRGBA *image.RGBA, nStats *NeedleStats, minX, minY, maxX, maxY int) []float64 {
+	nW, nH := nRGBA.Rect.Dx(), nRGBA.Rect.Dy()
+	hW, hH := hRGBA.Rect.Dx(), hRGBA.Rect.Dy()
+	cols, rows := maxX-minX+1, maxY-minY+1
+	t := fftTileSize(cols, rows, nW, nH)
+	plan := getFFTPlan(t)
+
+	// Spectra of the needle channels
+	needleSpec := make([]complex128, 3*t*t)
+	for c := 0; c < 3; c++ {
+		spec := needleSpec[c*t*t : (c+1)*t*t]
+		for y := 0; y < nH; y++ {
+			o := y * nRGBA.Stride
+			for x := 0; x < nW; x++ {
+				spec[y*t+x] = complex(float64(nRGBA.Pix[o+x*4+c]), 0)
+			}
+		}
+		plan.transform2D(spec, false)
+	}
+
+	scores := make([]float64, cols*rows)
+	vx, vy := t-nW+1, t-nH+1
+	tilesX, tilesY := (cols+vx-1)/vx, (rows+vy-1)/vy
+	norm := 1.0 / float64(t*t)
+	parallelFor(tilesX*tilesY, func(k int) {
+		tx, ty := minX+(k%tilesX)*vx, minY+(k/tilesX)*vy
+		scratch := plan.buf.Get().([]complex128)
+		defer plan.buf.Put(scratch)
+		buf, acc := scratch[:t*t], scratch[t*t:]
+		clear(acc)
+
+		// Sum of the cross-power spectra of all channels
+		for c := 0; c < 3; c++ {
+			clear(buf)
+			for y := 0; y < t && ty+y < hH; y++ {
+				o := (ty+y)*hRGBA.Stride + tx*4 + c
+				for x := 0; x < t && tx+x < hW; x++ {
+					buf[y*t+x] = complex(float64(hRGBA.Pix[o+x*4]), 0)
+				}
+			}
+			plan.transform2D(buf, false)
+			spec := needleSpec[c*t*t : (c+1)*t*t]
+			for idx := range acc {
+				acc[idx] += buf[idx] * cmplx.Conj(spec[idx])
+			}
+		}
+		plan.transform2D(acc, true)
+
+		// Only the positions where the needle fits in the tile are valid
+		for y := 0; y < vy && ty+y <= maxY; y++ {
+			for x := 0; x < vx && tx+x <= maxX; x++ {
+				dot := real(acc[y*t+x]) * norm
+				scores[(ty+y-minY)*cols+(tx+x-minX)] = nccFromDot(hInt, tx+x, ty+y, nW, nH, dot, nStats)
+			}
+		}
+	})
+	return scores
+}
+
+// compareNCCBackends scores the positions of the region on the level both by FFT and by computeNCCFast,
+// comparing them at every step-th position in both directions.
+// Returns the maximum absolute difference of the scores, or 0 if the region is empty.
+func compareNCCBackends(level *MapLevel, needle *pyramidNeedle, region image.Rectangle, step int) float64 {
+	hW, hH := level.Img.Rect.Dx(), level.Img.Rect.Dy()
+	minX, minY := max(0, region.Min.X), max(0, region.Min.Y)
+	maxX, maxY := min(hW-needle.W, region.Max.X-1), min(hH-needle.H, region.Max.Y-1)
+	if minX > maxX || minY > maxY {
+		return 0.0
+	}
+
+	scores := matchScoresFFT(level.Img, level.Integral, needle.Img, needle.Stats, minX, minY, maxX, maxY)
+	cols := maxX - minX + 1
+	maxDiff := 0.0
+	for y := minY; y <= maxY; y += step {
+		for x := minX; x <= maxX; x += step {
+			direct := computeNCCFast(level.Img, level.Integral, needle.Img, x, y, needle.Stats)
+			maxDiff = max(maxDiff, math.Abs(scores[(y-minY)*cols+(x-minX)]-direct))
+		}
+	}
+	return maxDiff
+}
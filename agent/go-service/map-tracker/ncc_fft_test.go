@@ -0,0 +1,139 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testMapDir is the map resource directory, relative to this package
+var testMapDir = filepath.Join("..", "..", "..", "assets", "resource", MAP_DIR)
+
+// nccTolerance is the maximum allowed difference between the FFT and the direct scores
+const nccTolerance = 1e-6
+
+// loadTestMap decodes the map image of the given name, skipping the test if it is not available
+func loadTestMap(tb testing.TB, name string) *image.RGBA {
+	tb.Helper()
+	file, err := os.Open(filepath.Join(testMapDir, name+".png"))
+	if err != nil {
+		tb.Skipf("map %s not available: %v", name, err)
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		tb.Fatalf("failed to decode map %s: %v", name, err)
+	}
+	return ToRGBA(img)
+}
+
+// newSyntheticImage returns a w x h image of smooth random patterns with noise and a flat block,
+// which is deterministic for the seed
+func newSyntheticImage(w, h int, seed int64) *image.RGBA {
+	rnd := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	var fx, fy, ph [3]float64
+	for c := range 3 {
+		fx[c], fy[c], ph[c] = rnd.Float64()*0.2, rnd.Float64()*0.2, rnd.Float64()*2*math.Pi
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			o := y*img.Stride + x*4
+			for c := range 3 {
+				v := 128 + 80*math.Sin(fx[c]*float64(x)+fy[c]*float64(y)+ph[c]) + rnd.NormFloat64()*20
+				img.Pix[o+c] = uint8(max(0, min(255, v)))
+			}
+			img.Pix[o+3] = 255
+		}
+	}
+	// A flat block, where the haystack deviation is zero
+	draw.Draw(img, image.Rect(w/4, h/4, w/4+w/8, h/4+h/8), image.NewUniform(img.At(0, 0)), image.Point{}, draw.Src)
+	return img
+}
+
+// testNeedles returns the unmasked and the masked needles cropped from the haystack at (x, y)
+func testNeedles(hRGBA *image.RGBA, x, y int) map[string]*pyramidNeedle {
+	g := DEFAULT_GEOMETRY
+	mask := buildMinimapMask(&g, nil)
+	crop := hRGBA.SubImage(image.Rect(x, y, x+mask.Rect.Dx(), y+mask.Rect.Dy()))
+	return map[string]*pyramidNeedle{
+		"unmasked": newPyramidNeedle(crop, nil, 1.0),
+		"masked":   newPyramidNeedle(crop, mask, 1.0),
+	}
+}
+
+// checkNCCBackends compares the FFT scores with the direct ones in the region, at every step-th position
+func checkNCCBackends(t *testing.T, hRGBA *image.RGBA, needles map[string]*pyramidNeedle, region image.Rectangle, step int) {
+	t.Helper()
+	level := &MapLevel{Scale: 1.0, Img: hRGBA, Integral: NewIntegralImage(hRGBA)}
+	for name, needle := range needles {
+		if diff := compareNCCBackends(level, needle, region, step); diff > nccTolerance {
+			t.Errorf("%s needle in %v: max score difference %g exceeds %g", name, region, diff, nccTolerance)
+		}
+	}
+}
+
+func TestMatchScoresFFTSynthetic(t *testing.T) {
+	hRGBA := newSyntheticImage(240, 200, 1)
+	needles := testNeedles(hRGBA, 60, 50)
+	checkNCCBackends(t, hRGBA, needles, hRGBA.Rect, 1)
+}
+
+func TestMatchScoresFFTSyntheticTiles(t *testing.T) {
+	// Large enough to be split into several FFT tiles
+	hRGBA := newSyntheticImage(700, 640, 2)
+	needles := testNeedles(hRGBA, 400, 300)
+	checkNCCBackends(t, hRGBA, needles, hRGBA.Rect, 7)
+}
+
+func TestMatchScoresFFTBorder(t *testing.T) {
+	hRGBA := newSyntheticImage(300, 260, 3)
+	w, h := hRGBA.Rect.Dx(), hRGBA.Rect.Dy()
+	// Needles cut from the corners, searched in regions reaching beyond the image
+	for _, pos := range []image.Point{{0, 0}, {w - 81, h - 81}} {
+		needles := testNeedles(hRGBA, pos.X, pos.Y)
+		checkNCCBackends(t, hRGBA, needles, image.Rect(pos.X-40, pos.Y-40, pos.X+40, pos.Y+40), 1)
+	}
+}
+
+func TestMatchScoresFFTRealMap(t *testing.T) {
+	hRGBA := loadTestMap(t, "map01_lv005")
+	w, h := hRGBA.Rect.Dx(), hRGBA.Rect.Dy()
+	cases := []struct {
+		name   string
+		pos    image.Point
+		region image.Rectangle
+	}{
+		{"center", image.Pt(w/2, h/2), image.Rect(w/2-48, h/2-48, w/2+48, h/2+48)},
+		{"top-left", image.Pt(0, 0), image.Rect(-16, -16, 64, 64)},
+		{"bottom-right", image.Pt(w-81, h-81), image.Rect(w-144, h-144, w, h)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			checkNCCBackends(t, hRGBA, testNeedles(hRGBA, c.pos.X, c.pos.Y), c.region, 1)
+		})
+	}
+}
+
+func TestMatchTemplateBackendsAgree(t *testing.T) {
+	hRGBA := loadTestMap(t, "map01_lv005")
+	hInt := NewIntegralImage(hRGBA)
+	for name, needle := range testNeedles(hRGBA, 200, 150) {
+		region := image.Rect(140, 90, 260, 210)
+		opts := NewMatchOptions(needle.W, needle.H, 1.0, MATCH_BACKEND_DIRECT)
+		dx, dy, ds := MatchTemplateInRegion(hRGBA, hInt, needle.Img, needle.Stats, region, opts)
+		opts.Backend = MATCH_BACKEND_FFT
+		fx, fy, fs := MatchTemplateInRegion(hRGBA, hInt, needle.Img, needle.Stats, region, opts)
+		if dx != fx || dy != fy || math.Abs(ds-fs) > nccTolerance {
+			t.Errorf("%s needle: direct (%d, %d, %f) != fft (%d, %d, %f)", name, dx, dy, ds, fx, fy, fs)
+		}
+		if fx != 200 || fy != 150 {
+			t.Errorf("%s needle found at (%d, %d), want (200, 150)", name, fx, fy)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/MaaXYZ/maa-framework-go/v4"
+	"github.com/rs/zerolog/log"
+)
+
+type MapTrackerNearest struct{}
+
+// MapTrackerNearestParam represents the custom_recognition_param for MapTrackerNearest
+type MapTrackerNearestParam struct {
+	// MapName restricts the inference to the given base map and its tier layers. All maps are considered if empty.
+	MapName string `json:"map_name,omitempty"`
+	// Category is the category of the POI to find (required).
+	Category string `json:"category"`
+	// Tags are the tags the POI must all have.
+	Tags []string `json:"tags,omitempty"`
+	// MaxDistance is the maximum distance to the POI in base map pixels. No limit if zero.
+	MaxDistance float64 `json:"max_distance,omitempty"`
+	// Track updates the tracking state of MapTrackerInfer with the inferred location.
+	// Off by default, so that the query does not interfere with a running MapTrackerMove.
+	Track bool `json:"track,omitempty"`
+	// Precision controls the inference precision/speed tradeoff.
+	Precision float64 `json:"precision,omitempty"`
+	// Threshold controls the minimum confidence required to consider the inference successful.
+	Threshold float64 `json:"threshold,omitempty"`
+}
+
+// MapTrackerNearestResult is the detail of a nearest POI hit
+type MapTrackerNearestResult struct {
+	// POI is the nearest POI.
+	POI POI `json:"poi"`
+	// MapName, X and Y are the location of the player, in base map coordinates.
+	MapName string `json:"mapName"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	// Distance is the straight-line distance from the player to the POI in base map pixels.
+	Distance float64 `json:"distance"`
+	// Bearing is the direction from the player to the POI (0-359 degrees, clockwise from up).
+	Bearing int `json:"bearing"`
+	// DeltaRot is the rotation from the player heading to the bearing (-180 to 180 degrees).
+	DeltaRot int `json:"deltaRot"`
+}
+
+var _ maa.CustomRecognitionRunner = &MapTrackerNearest{}
+
+// Run implements maa.CustomRecognitionRunner
+func (r *MapTrackerNearest) Run(ctx *maa.Context, arg *maa.CustomRecognitionArg) (*maa.CustomRecognitionResult, bool) {
+	param, err := r.parseParam(arg.CustomRecognitionParam)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse parameters for MapTrackerNearest")
+		return nil, false
+	}
+
+	mapNameRegex := ""
+	if param.MapName != "" {
+		mapNameRegex = calcMapNamesRegex([]string{param.MapName})
+	}
+	nodeName := "MapTrackerNearest_Infer"
+	config := map[string]any{
+		nodeName: map[string]any{
+			"recognition":        "Custom",
+			"custom_recognition": "MapTrackerInfer",
+			"custom_recognition_param": map[string]any{
+				"map_name_regex": mapNameRegex,
+				"precision":      param.Precision,
+				"threshold":      param.Threshold,
+				"track":          param.Track,
+			},
+		},
+	}
+	res, err := ctx.RunRecognition(nodeName, arg.Img, config)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to run MapTrackerInfer for nearest POI")
+		return nil, false
+	}
+	if res == nil || !res.Hit || res.DetailJson == "" {
+		log.Debug().Msg("Nearest POI location not inferred")
+		return nil, false
+	}
+	result, err := parseInferDetail(res.DetailJson)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse inference result")
+		return nil, false
+	}
+
+	// POIs are in base map coordinates, shared by the tier layers
+	db, err := loadPOIs(result.BaseMap)
+	if err != nil {
+		log.Error().Err(err).Str("map", result.BaseMap).Msg("Failed to load POI database")
+		return nil, false
+	}
+	poi, dist := db.Nearest(result.BaseX, result.BaseY, param.Category, param.Tags)
+	if poi == nil {
+		log.Debug().Str("map", result.BaseMap).Str("category", param.Category).Strs("tags", param.Tags).Msg("No matching POI found")
+		return nil, false
+	}
+	if param.MaxDistance > 0 && dist > param.MaxDistance {
+		log.Debug().Str("poi", poi.ID).Float64("distance", dist).Msg("Nearest POI is too far")
+		return nil, false
+	}
+
+	bearing := calcTargetRotation(result.BaseX, result.BaseY, poi.X, poi.Y)
+	hit := MapTrackerNearestResult{
+		POI:      *poi,
+		MapName:  result.BaseMap,
+		X:        result.BaseX,
+		Y:        result.BaseY,
+		Distance: dist,
+		Bearing:  bearing,
+		DeltaRot: calcDeltaRotation(result.Rot, bearing),
+	}
+	detail, err := json.Marshal(hit)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal nearest POI result")
+		return nil, false
+	}
+	log.Info().
+		Str("poi", poi.ID).
+		Str("category", poi.Category).
+		Float64("distance", dist).
+		Int("bearing", bearing).
+		Msg("Nearest POI found")
+	return &maa.CustomRecognitionResult{
+		Box:    arg.Roi,
+		Detail: string(detail),
+	}, true
+}
+
+func (r *MapTrackerNearest) parseParam(paramStr string) (*MapTrackerNearestParam, error) {
+	var param MapTrackerNearestParam
+	if paramStr != "" {
+		if err := json.Unmarshal([]byte(paramStr), &param); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal parameters: %w", err)
+		}
+	}
+
+	if param.Category == "" {
+		return nil, fmt.Errorf("category must be provided")
+	} else if !isPOICategory(param.Category) {
+		return nil, fmt.Errorf("unknown category %q", param.Category)
+	}
+	if param.MapName != "" && isTierName(param.MapName) {
+		return nil, fmt.Errorf("map_name must be a base map, got tier map %s", param.MapName)
+	}
+	if param.MaxDistance < 0 {
+		return nil, fmt.Errorf("max_distance must be non-negative")
+	}
+	// Precision and Threshold will be validated in MapTrackerInfer, omitted here
+
+	return &param, nil
+}
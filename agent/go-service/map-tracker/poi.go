@@ -0,0 +1,126 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// POI is a point of interest of a map, in base map coordinates
+type POI struct {
+	// ID is the unique identifier of the POI (required).
+	ID string `json:"id"`
+	// Name is an optional human-readable name.
+	Name string `json:"name,omitempty"`
+	// Category is one of "teleport", "resource", "shop", "npc" and "other" (required).
+	Category string `json:"category"`
+	// Tags are free-form labels to filter POIs of a category, e.g. the resource type.
+	Tags []string `json:"tags,omitempty"`
+	// X and Y are the coordinates of the POI on the base map (required).
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// POIDatabase is the POI resource of a base map
+type POIDatabase struct {
+	POIs []POI `json:"pois"`
+}
+
+// poiCacheEntry is a loaded POI database and the resource generation it was loaded at
+type poiCacheEntry struct {
+	db  *POIDatabase
+	gen uint64
+}
+
+var (
+	poiMu    sync.Mutex
+	poiCache = make(map[string]poiCacheEntry)
+)
+
+// loadPOIs returns the POI database of the given base map, shared by all callers.
+// It is loaded on first use and reloaded whenever resources have been loaded again since.
+func loadPOIs(mapName string) (*POIDatabase, error) {
+	gen := getResourceGeneration()
+	poiMu.Lock()
+	defer poiMu.Unlock()
+	if entry, ok := poiCache[mapName]; ok && entry.gen == gen {
+		return entry.db, nil
+	}
+
+	path := findResource(filepath.Join(POI_DIR, mapName+".json"))
+	if path == "" {
+		return nil, fmt.Errorf("POI database for map %s not found", mapName)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read POI database: %w", err)
+	}
+	var db POIDatabase
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal POI database: %w", err)
+	}
+	if err := db.validate(); err != nil {
+		return nil, fmt.Errorf("invalid POI database %s: %w", path, err)
+	}
+	poiCache[mapName] = poiCacheEntry{&db, gen}
+	return &db, nil
+}
+
+// validate checks the IDs and categories of the POIs
+func (db *POIDatabase) validate() error {
+	ids := make(map[string]struct{}, len(db.POIs))
+	for idx, p := range db.POIs {
+		if p.ID == "" {
+			return fmt.Errorf("POI at index %d has empty id", idx)
+		}
+		if _, exists := ids[p.ID]; exists {
+			return fmt.Errorf("duplicate POI id %q", p.ID)
+		}
+		ids[p.ID] = struct{}{}
+		if !isPOICategory(p.Category) {
+			return fmt.Errorf("POI %s has unknown category %q", p.ID, p.Category)
+		}
+	}
+	return nil
+}
+
+// isPOICategory reports whether the category is a known POI category
+func isPOICategory(category string) bool {
+	switch category {
+	case POI_TELEPORT, POI_RESOURCE, POI_SHOP, POI_NPC, POI_OTHER:
+		return true
+	}
+	return false
+}
+
+// Nearest returns the nearest POI of the category to (x, y) having all the given tags,
+// and its distance, or nil if there is none
+func (db *POIDatabase) Nearest(x, y int, category string, tags []string) (*POI, float64) {
+	var best *POI
+	bestDist := math.Inf(1)
+	for idx := range db.POIs {
+		p := &db.POIs[idx]
+		if p.Category != category || !p.hasTags(tags) {
+			continue
+		}
+		if d := math.Hypot(float64(p.X-x), float64(p.Y-y)); d < bestDist {
+			best, bestDist = p, d
+		}
+	}
+	return best, bestDist
+}
+
+// hasTags reports whether the POI has all the given tags
+func (p *POI) hasTags(tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(p.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPOIDatabaseNearest(t *testing.T) {
+	db := POIDatabase{POIs: []POI{
+		{ID: "anchor", Category: POI_TELEPORT, X: 100, Y: 100},
+		{ID: "iron_near", Category: POI_RESOURCE, Tags: []string{"iron"}, X: 110, Y: 100},
+		{ID: "iron_far", Category: POI_RESOURCE, Tags: []string{"iron", "rich"}, X: 200, Y: 100},
+		{ID: "copper", Category: POI_RESOURCE, Tags: []string{"copper"}, X: 101, Y: 100},
+	}}
+	cases := []struct {
+		name     string
+		category string
+		tags     []string
+		want     string
+		dist     float64
+	}{
+		{"category", POI_TELEPORT, nil, "anchor", 0},
+		{"any tags", POI_RESOURCE, nil, "copper", 1},
+		{"tag", POI_RESOURCE, []string{"iron"}, "iron_near", 10},
+		{"all tags", POI_RESOURCE, []string{"iron", "rich"}, "iron_far", 100},
+		{"no category", POI_SHOP, nil, "", 0},
+		{"no tag", POI_RESOURCE, []string{"gold"}, "", 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			poi, dist := db.Nearest(100, 100, c.category, c.tags)
+			if c.want == "" {
+				if poi != nil {
+					t.Errorf("found %s, want none", poi.ID)
+				}
+				return
+			}
+			if poi == nil || poi.ID != c.want || dist != c.dist {
+				t.Errorf("found %v at %.1f, want %s at %.1f", poi, dist, c.want, c.dist)
+			}
+		})
+	}
+}
+
+func TestPOIDatabaseValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		pois []POI
+		err  string
+	}{
+		{"valid", []POI{{ID: "a", Category: POI_NPC}, {ID: "b", Category: POI_OTHER}}, ""},
+		{"empty id", []POI{{Category: POI_SHOP}}, "empty id"},
+		{"duplicate id", []POI{{ID: "a", Category: POI_SHOP}, {ID: "a", Category: POI_NPC}}, "duplicate"},
+		{"unknown category", []POI{{ID: "a", Category: "chest"}}, "unknown category"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db := POIDatabase{POIs: c.pois}
+			err := db.validate()
+			if c.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("error %v, want one containing %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestPOIResources(t *testing.T) {
+	files, _ := filepath.Glob(filepath.Join("..", "..", "..", "assets", "resource", POI_DIR, "*.json"))
+	if len(files) == 0 {
+		t.Skip("POI resources not available")
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		var db POIDatabase
+		if err := json.Unmarshal(data, &db); err != nil {
+			t.Errorf("failed to unmarshal %s: %v", path, err)
+			continue
+		}
+		if err := db.validate(); err != nil {
+			t.Errorf("invalid %s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"image"
+	"math"
+	"slices"
+)
+
+// MapLevel represents one level of a map image pyramid
+type MapLevel struct {
+	Scale    float64
+	Img      *image.RGBA
+	Integral *IntegralImage
+}
+
+// buildPyramid builds the image pyramid of a map for all PYRAMID_SCALES.
+// Levels with scale 1.0 share the original image and integral image.
+func buildPyramid(img *image.RGBA, integral *IntegralImage) []MapLevel {
+	levels := make([]MapLevel, 0, len(PYRAMID_SCALES))
+	for _, scale := range PYRAMID_SCALES {
+		if scale == 1.0 {
+			levels = append(levels, MapLevel{scale, img, integral})
+			continue
+		}
+		sRGBA := ToRGBA(scaleImage(img, scale))
+		levels = append(levels, MapLevel{scale, sRGBA, NewIntegralImage(sRGBA)})
+	}
+	return levels
+}
+
+// pyramidLevel returns the index of the coarsest pyramid level
+// whose scale is not lower than the given precision
+func pyramidLevel(precision float64) int {
+	for idx, scale := range PYRAMID_SCALES {
+		if scale >= precision-1e-9 {
+			return idx
+		}
+	}
+	return len(PYRAMID_SCALES) - 1
+}
+
+// pyramidNeedle is the mini-map image scaled for one pyramid level
+type pyramidNeedle struct {
+	Img   *image.RGBA
+	Stats *NeedleStats
+	Scale float64
+	W, H  int
+}
+
+// newPyramidNeedle scales the mini-map image for matching at the given scale,
+// ignoring the pixels outside the mask if it is not nil
+func newPyramidNeedle(miniMap image.Image, mask *image.Gray, scale float64) *pyramidNeedle {
+	rgba := ToRGBA(scaleImage(miniMap, scale))
+	var stats *NeedleStats
+	if mask != nil {
+		// The masked pixels are zeroed, so never modify the screen image
+		rgba = cloneRGBA(rgba)
+		stats = GetMaskedNeedleStats(rgba, mask)
+	} else {
+		stats = GetNeedleStats(rgba)
+	}
+	return &pyramidNeedle{
+		Img:   rgba,
+		Stats: stats,
+		Scale: scale,
+		W:     rgba.Rect.Dx(),
+		H:     rgba.Rect.Dy(),
+	}
+}
+
+// newPyramidNeedles scales the mini-map image for pyramid levels 0 to target
+func newPyramidNeedles(miniMap image.Image, mask *image.Gray, target int) []*pyramidNeedle {
+	needles := make([]*pyramidNeedle, target+1)
+	for lv := 0; lv <= target; lv++ {
+		needles[lv] = newPyramidNeedle(miniMap, mask, PYRAMID_SCALES[lv])
+	}
+	return needles
+}
+
+// pyramidCandidate is a candidate match on some map,
+// where (X, Y) is the top-left position in the coordinates of the current level
+type pyramidCandidate struct {
+	Map   *MapCache
+	X, Y  int
+	Score float64
+}
+
+// mapPosition converts the candidate to the center position in original map coordinates
+func (c pyramidCandidate) mapPosition(needle *pyramidNeedle) (int, int) {
+	x := int(float64(c.X+needle.W/2)/needle.Scale) + c.Map.OffsetX
+	y := int(float64(c.Y+needle.H/2)/needle.Scale) + c.Map.OffsetY
+	return x, y
+}
+
+// refinePyramidCandidates keeps the best PYRAMID_CANDIDATES candidates found on level 0,
+// then re-matches each of them within a small window on every finer level up to target.
+// Returns the candidates on the target level, best first.
+func refinePyramidCandidates(candidates []pyramidCandidate, needles []*pyramidNeedle, target int, precision float64, backend string) []pyramidCandidate {
+	sortPyramidCandidates(candidates)
+	if len(candidates) > PYRAMID_CANDIDATES {
+		candidates = candidates[:PYRAMID_CANDIDATES]
+	}
+
+	for lv := 1; lv <= target; lv++ {
+		prev, cur := needles[lv-1], needles[lv]
+		ratio := cur.Scale / prev.Scale
+		r := int(math.Ceil(ratio*PYRAMID_REFINE_RADIUS)) + 1
+		opts := NewMatchOptions(cur.W, cur.H, precision, backend)
+		for idx := range candidates {
+			c := &candidates[idx]
+			level := &c.Map.Levels[lv]
+			// Project the candidate center onto this level
+			cx := int(float64(c.X+prev.W/2)*ratio) - cur.W/2
+			cy := int(float64(c.Y+prev.H/2)*ratio) - cur.H/2
+			region := image.Rect(cx-r, cy-r, cx+r+1, cy+r+1)
+			c.X, c.Y, c.Score = MatchTemplateInRegion(level.Img, level.Integral, cur.Img, cur.Stats, region, opts)
+		}
+	}
+
+	sortPyramidCandidates(candidates)
+	return candidates
+}
+
+// sortPyramidCandidates sorts the candidates by score in descending order
+func sortPyramidCandidates(candidates []pyramidCandidate) {
+	slices.SortFunc(candidates, func(a, b pyramidCandidate) int {
+		if a.Score > b.Score {
+			return -1
+		} else if a.Score < b.Score {
+			return 1
+		}
+		return 0
+	})
+}
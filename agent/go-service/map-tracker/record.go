@@ -0,0 +1,263 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MaaXYZ/MaaEnd/agent/go-service/pkg/maafocus"
+	"github.com/MaaXYZ/maa-framework-go/v4"
+	"github.com/rs/zerolog/log"
+)
+
+type MapTrackerRecord struct{}
+
+// MapTrackerRecordParam represents the custom_action_param for MapTrackerRecord
+type MapTrackerRecordParam struct {
+	// MapName is the base map to record on. If empty, the map recognized first is used.
+	MapName string `json:"map_name,omitempty"`
+	// Duration is the maximum recording time in milliseconds.
+	Duration int64 `json:"duration,omitempty"`
+	// IdleTimeout ends the recording once the player stays still for this time in milliseconds.
+	IdleTimeout int64 `json:"idle_timeout,omitempty"`
+	// MinDistance is the minimum distance between consecutive waypoints.
+	MinDistance float64 `json:"min_distance,omitempty"`
+	// TurnAngle is the minimum heading change in degrees to keep a waypoint.
+	TurnAngle float64 `json:"turn_angle,omitempty"`
+	// MaxSegment is the maximum distance between consecutive waypoints, even on straight lines.
+	MaxSegment float64 `json:"max_segment,omitempty"`
+	// Output is the output file name in the debug directory. Defaults to a timestamped name.
+	Output string `json:"output,omitempty"`
+	// Whether to suppress status printing for GUI.
+	NoPrint bool `json:"no_print,omitempty"`
+}
+
+//go:embed messages/recording_started.html
+var recordingStartedHTML string
+
+//go:embed messages/recording_finished.html
+var recordingFinishedHTML string
+
+var _ maa.CustomActionRunner = &MapTrackerRecord{}
+
+// Run implements maa.CustomActionRunner
+func (a *MapTrackerRecord) Run(ctx *maa.Context, arg *maa.CustomActionArg) bool {
+	param, err := a.parseParam(arg.CustomActionParam)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse parameters for MapTrackerRecord")
+		return false
+	}
+
+	ctrl := ctx.GetTasker().GetController()
+	if !param.NoPrint {
+		maafocus.NodeActionStarting(ctx, fmt.Sprintf(recordingStartedHTML, param.IdleTimeout/1000))
+	}
+
+	mapName, points := a.record(ctx, ctrl, param)
+	if mapName == "" || len(points) == 0 {
+		log.Error().Msg("No location recorded")
+		return false
+	}
+
+	path := simplifyTrajectory(points, param.MinDistance, param.TurnAngle, param.MaxSegment)
+	outPath, err := a.save(mapName, path, param.Output)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save recorded route")
+		return false
+	}
+
+	log.Info().
+		Str("map", mapName).
+		Int("samples", len(points)).
+		Int("waypoints", len(path)).
+		Str("path", outPath).
+		Msg("Route recorded")
+	if !param.NoPrint {
+		maafocus.NodeActionStarting(ctx, fmt.Sprintf(recordingFinishedHTML, mapName, len(path), outPath))
+	}
+	return true
+}
+
+// record samples the player location until the player stays idle, the duration elapses or the task stops.
+// Returns the base map name and the sampled trajectory in base map coordinates.
+func (a *MapTrackerRecord) record(ctx *maa.Context, ctrl *maa.Controller, param *MapTrackerRecordParam) (string, [][2]int) {
+	inferIntervalDuration := time.Duration(INFER_INTERVAL_MS) * time.Millisecond
+	mapName := param.MapName
+	points := make([][2]int, 0)
+
+	var (
+		startTime     = time.Now()
+		lastInferTime = time.Time{}
+		lastMoveTime  = time.Now()
+	)
+	for {
+		elapsed := time.Since(lastInferTime)
+		if elapsed < inferIntervalDuration {
+			time.Sleep(inferIntervalDuration - elapsed)
+		}
+		now := time.Now()
+		lastInferTime = now
+
+		if ctx.GetTasker().Stopping() {
+			log.Warn().Msg("Task is stopping, finishing recording")
+			break
+		}
+		if now.Sub(startTime).Milliseconds() > param.Duration {
+			log.Info().Msg("Recording duration reached")
+			break
+		}
+		// Only finish on idle after the player has started to move
+		if len(points) > 1 && now.Sub(lastMoveTime).Milliseconds() > param.IdleTimeout {
+			log.Info().Msg("Player stays idle, finishing recording")
+			break
+		}
+
+		mapNameRegex := DEFAULT_INFERENCE_PARAM.MapNameRegex
+		if mapName != "" {
+			mapNameRegex = calcTierRegex(mapName)
+		}
+		result, err := doInferRegex(ctx, ctrl, mapNameRegex)
+		if err != nil {
+			log.Debug().Err(err).Msg("Inference failed during recording")
+			continue
+		}
+		if mapName == "" {
+			mapName = result.BaseMap
+			log.Info().Str("map", mapName).Msg("Recording on recognized map")
+		}
+
+		x, y := calcFramePosition(result, mapName)
+		if len(points) > 0 && points[len(points)-1] == [2]int{x, y} {
+			continue
+		}
+		points = append(points, [2]int{x, y})
+		lastMoveTime = now
+	}
+	return mapName, points
+}
+
+// save writes the MapTrackerMove parameters of the route to the debug directory
+func (a *MapTrackerRecord) save(mapName string, path [][2]int, output string) (string, error) {
+	moveParam := MapTrackerMoveParam{MapName: mapName}
+	for _, p := range path {
+		moveParam.Path = append(moveParam.Path, Waypoint{X: p[0], Y: p[1]})
+	}
+	data, err := json.MarshalIndent(moveParam, "", "    ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal route: %w", err)
+	}
+
+	if output == "" {
+		output = fmt.Sprintf("map_tracker_record_%s_%s.json", mapName, time.Now().Format("20060102_150405"))
+	}
+	if err := os.MkdirAll(DEBUG_DIR, 0755); err != nil {
+		return "", fmt.Errorf("failed to create debug directory: %w", err)
+	}
+	outPath := filepath.Join(DEBUG_DIR, output)
+	if err := os.WriteFile(outPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write route: %w", err)
+	}
+	return outPath, nil
+}
+
+func (a *MapTrackerRecord) parseParam(paramStr string) (*MapTrackerRecordParam, error) {
+	var param MapTrackerRecordParam
+	if paramStr != "" {
+		if err := json.Unmarshal([]byte(paramStr), &param); err != nil {
+			return nil, fmt.Errorf("failed to parse parameters: %w", err)
+		}
+	}
+
+	if isTierName(param.MapName) {
+		return nil, fmt.Errorf("map_name must be a base map, got tier map %s", param.MapName)
+	}
+	if param.Output != "" && (filepath.Base(param.Output) != param.Output || !strings.HasSuffix(param.Output, ".json")) {
+		return nil, fmt.Errorf("output must be a plain .json file name, got %s", param.Output)
+	}
+
+	if param.Duration < 0 {
+		return nil, fmt.Errorf("duration must be non-negative")
+	} else if param.Duration == 0 {
+		param.Duration = DEFAULT_RECORDING_PARAM.Duration
+	}
+
+	if param.IdleTimeout < 0 {
+		return nil, fmt.Errorf("idle_timeout must be non-negative")
+	} else if param.IdleTimeout == 0 {
+		param.IdleTimeout = DEFAULT_RECORDING_PARAM.IdleTimeout
+	}
+
+	if param.MinDistance < 0 {
+		return nil, fmt.Errorf("min_distance must be non-negative")
+	} else if param.MinDistance == 0 {
+		param.MinDistance = DEFAULT_RECORDING_PARAM.MinDistance
+	}
+
+	if param.TurnAngle < 0 || param.TurnAngle > 180 {
+		return nil, fmt.Errorf("turn_angle must be between 0 and 180 degrees")
+	} else if param.TurnAngle == 0 {
+		param.TurnAngle = DEFAULT_RECORDING_PARAM.TurnAngle
+	}
+
+	if param.MaxSegment < 0 {
+		return nil, fmt.Errorf("max_segment must be non-negative")
+	} else if param.MaxSegment == 0 {
+		param.MaxSegment = DEFAULT_RECORDING_PARAM.MaxSegment
+	}
+
+	return &param, nil
+}
+
+// simplifyTrajectory reduces a sampled trajectory into waypoints.
+// A point is kept if it is at least minDist away from the last kept point, and either the
+// heading turns by at least turnAngle degrees there or the segment reaches maxSeg.
+// The last point is always kept.
+func simplifyTrajectory(points [][2]int, minDist, turnAngle, maxSeg float64) [][2]int {
+	if len(points) == 0 {
+		return nil
+	}
+	dist := func(a, b [2]int) float64 {
+		return math.Hypot(float64(a[0]-b[0]), float64(a[1]-b[1]))
+	}
+
+	kept := [][2]int{points[0]}
+	for i := 1; i < len(points)-1; i++ {
+		last, p := kept[len(kept)-1], points[i]
+		d := dist(last, p)
+		if d < minDist {
+			continue
+		}
+		if d >= maxSeg {
+			kept = append(kept, p)
+			continue
+		}
+
+		// Estimate the outgoing heading from the next point far enough away
+		next := -1
+		for j := i + 1; j < len(points); j++ {
+			if dist(p, points[j]) >= minDist {
+				next = j
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		in := calcTargetRotation(last[0], last[1], p[0], p[1])
+		out := calcTargetRotation(p[0], p[1], points[next][0], points[next][1])
+		if math.Abs(float64(calcDeltaRotation(in, out))) >= turnAngle {
+			kept = append(kept, p)
+		}
+	}
+
+	if end := points[len(points)-1]; len(points) > 1 && end != kept[len(kept)-1] {
+		kept = append(kept, end)
+	}
+	return kept
+}
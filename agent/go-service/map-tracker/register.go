@@ -9,5 +9,11 @@ func Register() {
 
 	maa.AgentServerRegisterCustomRecognition("MapTrackerInfer", &MapTrackerInfer{})
 	maa.AgentServerRegisterCustomRecognition("MapTrackerAssertLocation", &MapTrackerAssertLocation{})
+	maa.AgentServerRegisterCustomRecognition("MapTrackerMoveFailure", &MapTrackerMoveFailure{})
+	maa.AgentServerRegisterCustomRecognition("MapTrackerGeofence", &MapTrackerGeofence{})
+	maa.AgentServerRegisterCustomRecognition("MapTrackerNearest", &MapTrackerNearest{})
 	maa.AgentServerRegisterCustomAction("MapTrackerMove", &MapTrackerMove{})
+	maa.AgentServerRegisterCustomAction("MapTrackerNavigate", &MapTrackerNavigate{})
+	maa.AgentServerRegisterCustomAction("MapTrackerRecord", &MapTrackerRecord{})
+	maa.AgentServerRegisterCustomAction("MapTrackerRunRoute", &MapTrackerRunRoute{})
 }
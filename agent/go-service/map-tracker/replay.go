@@ -0,0 +1,399 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MaaXYZ/maa-framework-go/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// ReplayTruth is the ground truth of one recorded frame
+type ReplayTruth struct {
+	MapName string `json:"mapName"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Rot     int    `json:"rot"`
+}
+
+// ReplayOptions configures an offline replay of MapTrackerInfer.
+// It is used to evaluate inference against recorded screenshots without a game running.
+type ReplayOptions struct {
+	// ResourceDir is the resource root containing MAP_DIR and POINTER_PATH.
+	ResourceDir string
+	// FramesDir is the directory of recorded 1280x720 frames (PNG or JPEG).
+	FramesDir string
+	// TruthPath is the ground truth JSON file, mapping frame file names to ReplayTruth.
+	TruthPath string
+	// Precisions is the list of precision levels to evaluate.
+	Precisions []float64
+	// MapNameRegex filters which maps to consider, same as MapTrackerInferParam.
+	MapNameRegex string
+	// Threshold is the confidence threshold, same as MapTrackerInferParam.
+	Threshold float64
+	// Track replays frames in file name order as a continuous sequence in tracking mode.
+	Track bool
+	// NoRelocalize disables feature relocalization in tracking mode, same as MapTrackerInferParam.
+	NoRelocalize bool
+	// NoMask disables the mini-map mask, same as MapTrackerInferParam.
+	NoMask bool
+	// Geometry is the name of the geometry profile to use. The profile is selected as for Win32 if empty.
+	Geometry string
+	// Workers overrides the size of the template matching worker pool if positive.
+	Workers int
+	// Repeat runs the inference of each frame this many times to benchmark it, reporting the mean time.
+	Repeat int
+	// Backend is the template matching backend, same as MapTrackerInferParam.
+	Backend string
+	// CheckBackends compares the scores of the FFT and the direct matching backends
+	// around the ground truth of each frame on the pyramid level of each precision.
+	CheckBackends bool
+}
+
+// ReplayFrameResult is the inference outcome of one frame at one precision level
+type ReplayFrameResult struct {
+	File      string                `json:"file"`
+	Precision float64               `json:"precision"`
+	Truth     ReplayTruth           `json:"truth"`
+	Result    MapTrackerInferResult `json:"result"`
+	MapOK     bool                  `json:"mapOk"`
+	LocError  float64               `json:"locError"`
+	RotError  int                   `json:"rotError"`
+	Hit       bool                  `json:"hit"`
+	// InferMs is the mean wall time of the whole inference in milliseconds
+	InferMs float64 `json:"inferMs"`
+	// BackendDiff is the maximum score difference between matching backends, if checked
+	BackendDiff float64 `json:"backendDiff"`
+}
+
+// ReplayStats is a summary of a sample distribution
+type ReplayStats struct {
+	Mean float64 `json:"mean"`
+	Min  float64 `json:"min"`
+	P10  float64 `json:"p10"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	Max  float64 `json:"max"`
+}
+
+// ReplayLevelSummary aggregates replay results for one precision level
+type ReplayLevelSummary struct {
+	Precision   float64     `json:"precision"`
+	Frames      int         `json:"frames"`
+	Hits        int         `json:"hits"`
+	MapAccuracy float64     `json:"mapAccuracy"`
+	LocError    ReplayStats `json:"locError"`
+	RotError    ReplayStats `json:"rotError"`
+	LocConf     ReplayStats `json:"locConf"`
+	RotConf     ReplayStats `json:"rotConf"`
+	// LocConfHist counts location confidences in 10 buckets of width 0.1 over [0, 1]
+	LocConfHist [10]int     `json:"locConfHist"`
+	LocTimeMs   ReplayStats `json:"locTimeMs"`
+	RotTimeMs   ReplayStats `json:"rotTimeMs"`
+	InferMs     ReplayStats `json:"inferMs"`
+	BackendDiff ReplayStats `json:"backendDiff"`
+}
+
+// ReplayReport is the full result of RunReplay
+type ReplayReport struct {
+	Levels []ReplayLevelSummary `json:"levels"`
+	Frames []ReplayFrameResult  `json:"frames"`
+	// Resources is the report of loading the map-tracker resources
+	Resources *ResourceLoadReport `json:"resources"`
+}
+
+// RunReplay loads recorded frames with their ground truth and runs location and rotation
+// inference on each of them for every precision level in opts, using the same map cache
+// and template matching path as MapTrackerInfer.
+// It returns an error if resources, frames or the ground truth cannot be loaded.
+func RunReplay(opts ReplayOptions) (*ReplayReport, error) {
+	if len(opts.Precisions) == 0 {
+		opts.Precisions = []float64{DEFAULT_INFERENCE_PARAM.Precision}
+	}
+	if opts.MapNameRegex == "" {
+		opts.MapNameRegex = DEFAULT_INFERENCE_PARAM.MapNameRegex
+	}
+	if opts.Threshold == 0.0 {
+		opts.Threshold = DEFAULT_INFERENCE_PARAM.Threshold
+	}
+	if opts.Repeat <= 0 {
+		opts.Repeat = 1
+	}
+	switch opts.Backend {
+	case "":
+		opts.Backend = DEFAULT_INFERENCE_PARAM.Backend
+	case MATCH_BACKEND_AUTO, MATCH_BACKEND_DIRECT, MATCH_BACKEND_FFT:
+	default:
+		return nil, fmt.Errorf("invalid backend: %s", opts.Backend)
+	}
+	setMatchWorkers(opts.Workers)
+	mapNameRegex, err := regexp.Compile(opts.MapNameRegex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid map name regex: %w", err)
+	}
+
+	// Load ground truth
+	data, err := os.ReadFile(opts.TruthPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ground truth: %w", err)
+	}
+	truths := make(map[string]ReplayTruth)
+	if err := json.Unmarshal(data, &truths); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ground truth: %w", err)
+	}
+
+	// Load frames
+	frames, err := loadReplayFrames(opts.FramesDir, truths)
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no frames with ground truth found in %s", opts.FramesDir)
+	}
+
+	// Initialize resources through the regular search path
+	resourceDir, err := filepath.Abs(opts.ResourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resource directory: %w", err)
+	}
+	resourcePath.Store(resourceDir)
+
+	i := &MapTrackerInfer{}
+	i.initResources(nil)
+	if i.mapsErr != nil {
+		return nil, i.mapsErr
+	}
+	if i.pointerErr != nil {
+		return nil, i.pointerErr
+	}
+
+	geometry, err := selectReplayGeometry(i, opts.Geometry, frames[0].img)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReplayReport{Resources: i.getLoadReport()}
+	for _, precision := range opts.Precisions {
+		if precision <= 0.0 || precision > 1.0 {
+			return nil, fmt.Errorf("invalid precision value: %f", precision)
+		}
+		param := &MapTrackerInferParam{
+			MapNameRegex: opts.MapNameRegex,
+			Precision:    precision,
+			Threshold:    opts.Threshold,
+			Track:        opts.Track,
+			NoRelocalize: opts.NoRelocalize,
+			Backend:      opts.Backend,
+			NoMask:       opts.NoMask,
+		}
+
+		var last *trackState
+		levelResults := make([]ReplayFrameResult, 0, len(frames))
+		for _, f := range frames {
+			var res *MapTrackerInferResult
+			start := time.Now()
+			for range opts.Repeat {
+				res = i.infer(f.img, geometry, param, mapNameRegex, last, nil)
+			}
+			inferMs := float64(time.Since(start).Microseconds()) / 1000 / float64(opts.Repeat)
+			if opts.Track {
+				last = nil
+				if res.LocConf > opts.Threshold && res.RotConf > opts.Threshold {
+					last = &trackState{res.MapName, res.X, res.Y}
+				}
+			}
+			levelResults = append(levelResults, ReplayFrameResult{
+				File:      f.name,
+				Precision: precision,
+				Truth:     f.truth,
+				Result:    *res,
+				MapOK:     res.MapName == f.truth.MapName,
+				LocError:  math.Hypot(float64(res.X-f.truth.X), float64(res.Y-f.truth.Y)),
+				RotError:  absInt(calcDeltaRotation(res.Rot, f.truth.Rot)),
+				Hit:       res.LocConf > opts.Threshold && res.RotConf > opts.Threshold,
+				InferMs:   inferMs,
+			})
+			if opts.CheckBackends {
+				diff := i.compareReplayBackends(f, geometry, param)
+				levelResults[len(levelResults)-1].BackendDiff = diff
+				if diff > 1e-6 {
+					log.Warn().Str("file", f.name).Float64("precision", precision).Float64("diff", diff).Msg("Matching backends disagree")
+				}
+			}
+		}
+
+		summary := summarizeReplayLevel(precision, levelResults)
+		log.Info().
+			Float64("precision", precision).
+			Int("frames", summary.Frames).
+			Int("hits", summary.Hits).
+			Float64("mapAccuracy", summary.MapAccuracy).
+			Float64("locErrorP50", summary.LocError.P50).
+			Float64("rotErrorP50", summary.RotError.P50).
+			Float64("locTimeMsMean", summary.LocTimeMs.Mean).
+			Float64("inferMsMean", summary.InferMs.Mean).
+			Msg("Replay level completed")
+
+		report.Levels = append(report.Levels, summary)
+		report.Frames = append(report.Frames, levelResults...)
+	}
+
+	return report, nil
+}
+
+// compareReplayBackends compares the matching backends for the mini-map of the frame
+// within FFT_CHECK_RADIUS of its ground truth, on the pyramid level of the precision.
+// Returns the maximum score difference, or 0 if the ground truth map is not loaded.
+func (i *MapTrackerInfer) compareReplayBackends(f replayFrame, geometry *MinimapGeometry, param *MapTrackerInferParam) float64 {
+	m := i.findMap(f.truth.MapName)
+	if m == nil {
+		return 0.0
+	}
+	var mask *image.Gray
+	if !param.NoMask {
+		mask = buildMinimapMask(geometry, i.masks[geometry.Mask])
+	}
+	level := &m.Levels[pyramidLevel(param.Precision)]
+	needle := newPyramidNeedle(geometry.cropMinimap(f.img), mask, level.Scale)
+	cx := int(float64(f.truth.X-m.OffsetX)*level.Scale) - needle.W/2
+	cy := int(float64(f.truth.Y-m.OffsetY)*level.Scale) - needle.H/2
+	region := image.Rect(cx-FFT_CHECK_RADIUS, cy-FFT_CHECK_RADIUS, cx+FFT_CHECK_RADIUS+1, cy+FFT_CHECK_RADIUS+1)
+	return compareNCCBackends(level, needle, region, FFT_CHECK_STEP)
+}
+
+// selectReplayGeometry returns the geometry of the named profile, or the geometry
+// selected for the replay resource if name is empty
+func selectReplayGeometry(i *MapTrackerInfer, name string, img image.Image) (*MinimapGeometry, error) {
+	if name == "" {
+		return i.getGeometry(maa.Tasker{}, img), nil
+	}
+	for idx := range i.profiles {
+		if i.profiles[idx].Name == name {
+			return &i.profiles[idx].MinimapGeometry, nil
+		}
+	}
+	return nil, fmt.Errorf("geometry profile %s not found", name)
+}
+
+type replayFrame struct {
+	name  string
+	img   image.Image
+	truth ReplayTruth
+}
+
+// loadReplayFrames loads all frames in dir that have a ground truth entry,
+// rescaling them to the 1280x720 working resolution if needed
+func loadReplayFrames(dir string, truths map[string]ReplayTruth) ([]replayFrame, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read frames directory: %w", err)
+	}
+
+	frames := make([]replayFrame, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if ext != ".png" && ext != ".jpg" && ext != ".jpeg" {
+			continue
+		}
+		truth, ok := truths[name]
+		if !ok {
+			log.Warn().Str("file", name).Msg("No ground truth for frame, skipped")
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open frame %s: %w", name, err)
+		}
+		img, _, err := image.Decode(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode frame %s: %w", name, err)
+		}
+
+		b := img.Bounds()
+		if b.Dx() != WORK_W || b.Dy() != WORK_H {
+			log.Warn().Str("file", name).Int("w", b.Dx()).Int("h", b.Dy()).Msg("Frame is not 1280x720, rescaling")
+			img = scaleImage(img, float64(WORK_W)/float64(b.Dx()))
+		}
+		frames = append(frames, replayFrame{name, ToRGBA(img), truth})
+	}
+	return frames, nil
+}
+
+// summarizeReplayLevel computes the distribution statistics of one precision level
+func summarizeReplayLevel(precision float64, results []ReplayFrameResult) ReplayLevelSummary {
+	s := ReplayLevelSummary{Precision: precision, Frames: len(results)}
+	var locErr, rotErr, locConf, rotConf, locTime, rotTime, inferTime, backendDiff []float64
+	mapOK := 0
+	for _, r := range results {
+		if r.Hit {
+			s.Hits++
+		}
+		if r.MapOK {
+			mapOK++
+			locErr = append(locErr, r.LocError)
+		}
+		rotErr = append(rotErr, float64(r.RotError))
+		locConf = append(locConf, r.Result.LocConf)
+		rotConf = append(rotConf, r.Result.RotConf)
+		locTime = append(locTime, float64(r.Result.LocTimeMs))
+		rotTime = append(rotTime, float64(r.Result.RotTimeMs))
+		inferTime = append(inferTime, r.InferMs)
+		backendDiff = append(backendDiff, r.BackendDiff)
+
+		bucket := min(max(int(r.Result.LocConf*10), 0), 9)
+		s.LocConfHist[bucket]++
+	}
+	if len(results) > 0 {
+		s.MapAccuracy = float64(mapOK) / float64(len(results))
+	}
+	// Location error is only meaningful when the map is correct
+	s.LocError = calcReplayStats(locErr)
+	s.RotError = calcReplayStats(rotErr)
+	s.LocConf = calcReplayStats(locConf)
+	s.RotConf = calcReplayStats(rotConf)
+	s.LocTimeMs = calcReplayStats(locTime)
+	s.RotTimeMs = calcReplayStats(rotTime)
+	s.InferMs = calcReplayStats(inferTime)
+	s.BackendDiff = calcReplayStats(backendDiff)
+	return s
+}
+
+func calcReplayStats(values []float64) ReplayStats {
+	if len(values) == 0 {
+		return ReplayStats{}
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	pct := func(p float64) float64 {
+		return sorted[int(math.Round(p*float64(len(sorted)-1)))]
+	}
+	return ReplayStats{
+		Mean: sum / float64(len(sorted)),
+		Min:  sorted[0],
+		P10:  pct(0.1),
+		P50:  pct(0.5),
+		P90:  pct(0.9),
+		Max:  sorted[len(sorted)-1],
+	}
+}
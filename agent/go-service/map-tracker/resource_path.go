@@ -4,6 +4,7 @@ package maptracker
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"sync/atomic"
 
@@ -13,7 +14,10 @@ import (
 
 var (
 	resourcePath     atomic.Value // string
+	resourcePaths    atomic.Value // []string
 	registerSinkOnce sync.Once
+	// resourceGeneration is increased on every resource load, so that caches can tell when to reload
+	resourceGeneration atomic.Uint64
 )
 
 // ensureResourcePathSink ensures the resource path sink is registered
@@ -26,7 +30,7 @@ func ensureResourcePathSink() {
 
 type resourcePathSink struct{}
 
-// OnResourceLoading captures the resource path when a resource is loaded
+// OnResourceLoading captures the resource paths when resources are loaded
 func (c *resourcePathSink) OnResourceLoading(resource *maa.Resource, status maa.EventStatus, detail maa.ResourceLoadingDetail) {
 	if status != maa.EventStatusSucceeded || detail.Path == "" {
 		return
@@ -36,7 +40,31 @@ func (c *resourcePathSink) OnResourceLoading(resource *maa.Resource, status maa.
 		abs = p
 	}
 	resourcePath.Store(abs)
-	log.Debug().Str("resource_path", abs).Msg("Resource loaded; cached path for map-tracker")
+
+	// Loading an already loaded path again starts a new chain of resource paths
+	paths := getResourcePaths()
+	if idx := slices.Index(paths, abs); idx >= 0 {
+		paths = paths[:idx]
+	}
+	resourcePaths.Store(append(slices.Clone(paths), abs))
+	gen := resourceGeneration.Add(1)
+	log.Debug().Str("resource_path", abs).Uint64("generation", gen).Msg("Resource loaded; cached path for map-tracker")
+}
+
+// getResourceGeneration returns the number of resource loads seen so far
+func getResourceGeneration() uint64 {
+	return resourceGeneration.Load()
+}
+
+// getResourcePaths returns all cached resource paths in loading order
+func getResourcePaths() []string {
+	if v := resourcePaths.Load(); v != nil {
+		return v.([]string)
+	}
+	if base := getResourceBase(); base != "" {
+		return []string{base}
+	}
+	return nil
 }
 
 // getResourceBase returns the cached resource path or common defaults as fallback
@@ -51,9 +79,10 @@ func getResourceBase() string {
 
 // findResource tries to find a file in the cached resource path or standard fallbacks
 func findResource(relativePath string) string {
-	// 1. Try cached path from sink
-	if base := getResourceBase(); base != "" {
-		path := filepath.Join(base, relativePath)
+	// 1. Try cached paths from sink, later ones override earlier ones
+	paths := getResourcePaths()
+	for idx := len(paths) - 1; idx >= 0; idx-- {
+		path := filepath.Join(paths[idx], relativePath)
 		if _, err := os.Stat(path); err == nil {
 			return path
 		}
@@ -0,0 +1,100 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Severities of a resource load issue
+const (
+	LOAD_ISSUE_ERROR   = "error"
+	LOAD_ISSUE_WARNING = "warning"
+)
+
+// ResourceLoadReport is the structured report of loading the map-tracker resources
+type ResourceLoadReport struct {
+	// Generation is the resource generation the resources were loaded at
+	Generation uint64 `json:"generation"`
+	// MapDir is the resolved map directory
+	MapDir string `json:"mapDir"`
+	// Maps are the successfully loaded maps
+	Maps []MapLoadEntry `json:"maps"`
+	// PointerPath is the resolved pointer template path
+	PointerPath string `json:"pointerPath"`
+	// Issues are the problems found while loading
+	Issues []ResourceLoadIssue `json:"issues"`
+}
+
+// MapLoadEntry describes a loaded map
+type MapLoadEntry struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`  // Width of the original image
+	Height int    `json:"height"` // Height of the original image
+	// Rect is the crop rect from map_rect.json after clipping, or nil if not cropped
+	Rect *[4]int `json:"rect,omitempty"`
+	Tier string  `json:"tier,omitempty"`
+}
+
+// ResourceLoadIssue is a problem found while loading resources
+type ResourceLoadIssue struct {
+	Severity string `json:"severity"`
+	// Name is the map name or the resource file the issue refers to
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+func (r *ResourceLoadReport) addIssue(severity, name, format string, args ...any) {
+	r.Issues = append(r.Issues, ResourceLoadIssue{severity, name, fmt.Sprintf(format, args...)})
+}
+
+// Errors returns the number of issues with error severity
+func (r *ResourceLoadReport) Errors() int {
+	count := 0
+	for _, issue := range r.Issues {
+		if issue.Severity == LOAD_ISSUE_ERROR {
+			count++
+		}
+	}
+	return count
+}
+
+// log writes the summary and every issue of the report to the log
+func (r *ResourceLoadReport) log() {
+	for _, issue := range r.Issues {
+		e := log.Warn()
+		if issue.Severity == LOAD_ISSUE_ERROR {
+			e = log.Error()
+		}
+		e.Str("name", issue.Name).Str("issue", issue.Message).Msg("Map-tracker resource issue")
+	}
+	log.Info().
+		Uint64("generation", r.Generation).
+		Int("mapsCount", len(r.Maps)).
+		Int("errors", r.Errors()).
+		Int("warnings", len(r.Issues)-r.Errors()).
+		Msg("Map-tracker resources loaded")
+}
+
+// validateMapRect checks a map_rect.json entry against the image size.
+// Returns the rect clipped to the image, or false if the entry is unusable.
+func validateMapRect(report *ResourceLoadReport, name string, r []int, w, h int) ([4]int, bool) {
+	if len(r) != 4 {
+		report.addIssue(LOAD_ISSUE_ERROR, name, "map_rect.json entry must have 4 integers, got %d", len(r))
+		return [4]int{}, false
+	}
+	if r[0] >= r[2] || r[1] >= r[3] {
+		report.addIssue(LOAD_ISSUE_ERROR, name, "map_rect.json entry %v is empty or inverted", r)
+		return [4]int{}, false
+	}
+	clipped := [4]int{max(r[0], 0), max(r[1], 0), min(r[2], w), min(r[3], h)}
+	if clipped[0] >= clipped[2] || clipped[1] >= clipped[3] {
+		report.addIssue(LOAD_ISSUE_ERROR, name, "map_rect.json entry %v is outside of the %dx%d image", r, w, h)
+		return [4]int{}, false
+	}
+	if clipped != [4]int(r) {
+		report.addIssue(LOAD_ISSUE_WARNING, name, "map_rect.json entry %v exceeds the %dx%d image, clipped to %v", r, w, h, clipped)
+	}
+	return clipped, true
+}
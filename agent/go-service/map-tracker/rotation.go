@@ -0,0 +1,123 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"image"
+	"math"
+)
+
+// polarImage is a polar unwrap of an image around a center.
+// Angles are sampled clockwise starting from the top, in ROT_POLAR_BINS bins,
+// and radii are sampled in ROT_POLAR_RINGS rings between ROT_POLAR_MIN_RADIUS and ROT_POLAR_MAX_RADIUS.
+type polarImage struct {
+	// Data holds the samples indexed by [bin][ring][channel]
+	Data []float64
+	// Mean and Dev are the mean and the root of the sum of squared deviations of Data
+	Mean, Dev float64
+}
+
+// polarStride is the number of samples in one angle bin
+const polarStride = ROT_POLAR_RINGS * 3
+
+// unwrapPolar samples the image on a polar grid around (cx, cy) with bilinear interpolation
+func unwrapPolar(img *image.RGBA, cx, cy float64) *polarImage {
+	data := make([]float64, ROT_POLAR_BINS*polarStride)
+	ringStep := (ROT_POLAR_MAX_RADIUS - ROT_POLAR_MIN_RADIUS) / float64(ROT_POLAR_RINGS-1)
+	for b := 0; b < ROT_POLAR_BINS; b++ {
+		rad := float64(b) * 2 * math.Pi / ROT_POLAR_BINS
+		sin, cos := math.Sin(rad), math.Cos(rad)
+		for r := 0; r < ROT_POLAR_RINGS; r++ {
+			radius := ROT_POLAR_MIN_RADIUS + float64(r)*ringStep
+			o := b*polarStride + r*3
+			sampleBilinear(img, cx+radius*sin, cy-radius*cos, data[o:o+3])
+		}
+	}
+
+	var sum, sumSq float64
+	for _, v := range data {
+		sum += v
+		sumSq += v * v
+	}
+	cnt := float64(len(data))
+	mean := sum / cnt
+	return &polarImage{Data: data, Mean: mean, Dev: math.Sqrt(max(sumSq-cnt*mean*mean, 0))}
+}
+
+// sampleBilinear writes the interpolated RGB value at (x, y) into dst,
+// where (x, y) is in pixel-center coordinates and out-of-bounds pixels are black
+func sampleBilinear(img *image.RGBA, x, y float64, dst []float64) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	x, y = x-0.5, y-0.5
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	dst[0], dst[1], dst[2] = 0, 0, 0
+	for dy := 0; dy <= 1; dy++ {
+		for dx := 0; dx <= 1; dx++ {
+			px, py := x0+dx, y0+dy
+			if px < 0 || px >= w || py < 0 || py >= h {
+				continue
+			}
+			wt := (1 - math.Abs(float64(dx)-fx)) * (1 - math.Abs(float64(dy)-fy))
+			o := py*img.Stride + px*4
+			dst[0] += wt * float64(img.Pix[o])
+			dst[1] += wt * float64(img.Pix[o+1])
+			dst[2] += wt * float64(img.Pix[o+2])
+		}
+	}
+}
+
+// correlatePolar computes the NCC between the shifted patch and the template for every angle bin,
+// where scores[s] compares patch bin (b + s) with template bin b
+func correlatePolar(patch, tmpl *polarImage, scores []float64) {
+	denom := patch.Dev * tmpl.Dev
+	n := len(tmpl.Data)
+	if denom < 1e-6 {
+		clear(scores)
+		return
+	}
+	// Repeat the patch once so that every shift is a contiguous window
+	wrapped := append(patch.Data[:n:n], patch.Data...)
+	for s := 0; s < ROT_POLAR_BINS; s++ {
+		window := wrapped[s*polarStride : s*polarStride+n]
+		var dot float64
+		for k, v := range tmpl.Data {
+			dot += window[k] * v
+		}
+		scores[s] = (dot - float64(n)*patch.Mean*tmpl.Mean) / denom
+	}
+}
+
+// estimateRotation finds the clockwise rotation of the pointer in the patch relative to the template.
+// The patch is unwrapped around a few centers near its middle to tolerate small misalignment,
+// and the best circular correlation peak is refined to sub-bin accuracy by parabolic interpolation.
+// Returns (angle in degrees within [0, 360), confidence, scores of every angle bin at the best center)
+func estimateRotation(patch *image.RGBA, tmpl *polarImage) (float64, float64, []float64) {
+	cx, cy := float64(patch.Rect.Dx())/2, float64(patch.Rect.Dy())/2
+	scores := make([]float64, ROT_POLAR_BINS)
+	bestScores := make([]float64, ROT_POLAR_BINS)
+	bestShift, bestVal := 0, -1.0
+
+	for dy := -ROT_CENTER_SEARCH; dy <= ROT_CENTER_SEARCH; dy++ {
+		for dx := -ROT_CENTER_SEARCH; dx <= ROT_CENTER_SEARCH; dx++ {
+			polar := unwrapPolar(patch, cx+float64(dx), cy+float64(dy))
+			correlatePolar(polar, tmpl, scores)
+			for s, v := range scores {
+				if v > bestVal {
+					bestShift, bestVal = s, v
+					copy(bestScores, scores)
+				}
+			}
+		}
+	}
+
+	// Parabolic refinement around the peak
+	prev := bestScores[(bestShift+ROT_POLAR_BINS-1)%ROT_POLAR_BINS]
+	next := bestScores[(bestShift+1)%ROT_POLAR_BINS]
+	offset := 0.0
+	if d := prev - 2*bestVal + next; d < -1e-9 {
+		offset = math.Max(-0.5, math.Min(0.5, 0.5*(prev-next)/d))
+	}
+	angle := (float64(bestShift) + offset) * 360.0 / ROT_POLAR_BINS
+	angle = math.Mod(angle+360.0, 360.0)
+	return angle, bestVal, bestScores
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadTestPointer decodes the pointer template, skipping the test if it is not available
+func loadTestPointer(tb testing.TB) *image.RGBA {
+	tb.Helper()
+	file, err := os.Open(filepath.Join("..", "..", "..", "assets", "resource", POINTER_PATH))
+	if err != nil {
+		tb.Skipf("pointer template not available: %v", err)
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		tb.Fatalf("failed to decode pointer template: %v", err)
+	}
+	return ToRGBA(img)
+}
+
+// rotateClockwise rotates the image clockwise by deg degrees around its center with bilinear interpolation
+func rotateClockwise(src *image.RGBA, deg float64) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	cx, cy := float64(w)/2, float64(h)/2
+	sin, cos := math.Sincos(deg * math.Pi / 180.0)
+	px := make([]float64, 3)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Rotate the pixel center back to the source
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			sampleBilinear(src, cx+dx*cos+dy*sin, cy-dx*sin+dy*cos, px)
+			o := y*dst.Stride + x*4
+			dst.Pix[o], dst.Pix[o+1], dst.Pix[o+2], dst.Pix[o+3] = uint8(math.Round(px[0])), uint8(math.Round(px[1])), uint8(math.Round(px[2])), 255
+		}
+	}
+	return dst
+}
+
+func TestEstimateRotation(t *testing.T) {
+	pointer := loadTestPointer(t)
+	tmpl := unwrapPolar(pointer, float64(pointer.Rect.Dx())/2, float64(pointer.Rect.Dy())/2)
+
+	// Angles between the correlation bins must be refined to sub-degree accuracy
+	var sumDiff float64
+	n := 0
+	for want := 0.0; want < 360.0; want += 0.7 {
+		angle, conf, _ := estimateRotation(rotateClockwise(pointer, want), tmpl)
+		diff := math.Abs(math.Mod(angle-want+540.0, 360.0) - 180.0)
+		if diff >= 1.0 {
+			t.Errorf("rotation %.1f estimated as %.2f, off by %.2f degrees", want, angle, diff)
+		}
+		if conf < 0.95 {
+			t.Errorf("rotation %.1f has confidence %.3f, want at least 0.95", want, conf)
+		}
+		sumDiff += diff
+		n++
+	}
+	if mean := sumDiff / float64(n); mean > 0.25 {
+		t.Errorf("mean rotation error %.3f degrees exceeds 0.25", mean)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// RouteRef references a route of the route library.
+// In JSON, it is either the route name or an object with a "name" field and options.
+type RouteRef struct {
+	// Name is the route name, i.e. the file name without extension in ROUTE_DIR (required).
+	Name string `json:"name"`
+	// Reverse walks the route backwards.
+	Reverse bool `json:"reverse,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (r *RouteRef) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		*r = RouteRef{}
+		return json.Unmarshal(data, &r.Name)
+	}
+	type plain RouteRef
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+// loadRoute loads a route from the route library on top of the given movement parameters.
+// A route file has the same format as the MapTrackerMove parameters, and the parameters
+// set in it override those in base.
+func loadRoute(ref RouteRef, base *MapTrackerMoveParam) (*MapTrackerMoveParam, error) {
+	if ref.Name == "" || filepath.Base(ref.Name) != ref.Name {
+		return nil, fmt.Errorf("invalid route name %q", ref.Name)
+	}
+	path := findResource(filepath.Join(ROUTE_DIR, ref.Name+".json"))
+	if path == "" {
+		return nil, fmt.Errorf("route %s not found", ref.Name)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read route %s: %w", ref.Name, err)
+	}
+
+	param := *base
+	param.MapName, param.Path = "", nil
+	if err := json.Unmarshal(data, &param); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal route %s: %w", ref.Name, err)
+	}
+	if param.MapName == "" {
+		return nil, fmt.Errorf("route %s has no map_name", ref.Name)
+	}
+	if len(param.Path) == 0 {
+		return nil, fmt.Errorf("route %s has no path", ref.Name)
+	}
+	if ref.Reverse {
+		param.reversePath()
+	}
+	if err := param.normalize(); err != nil {
+		return nil, fmt.Errorf("invalid route %s: %w", ref.Name, err)
+	}
+	return &param, nil
+}
+
+// reversePath reverses the path in place, moving the map switches so that every point
+// stays on its map: the map of the last point becomes the map_name of param, and each
+// map_name marker is moved to the first point of its map segment in the new order
+func (param *MapTrackerMoveParam) reversePath() {
+	maps := make([]string, len(param.Path))
+	for i := range param.Path {
+		maps[i] = param.waypointMap(i)
+	}
+	path := slices.Clone(param.Path)
+	slices.Reverse(path)
+	slices.Reverse(maps)
+
+	param.MapName = maps[0]
+	for i := range path {
+		path[i].MapName = ""
+		if i > 0 && maps[i] != maps[i-1] {
+			path[i].MapName = maps[i]
+		}
+	}
+	param.Path = path
+}
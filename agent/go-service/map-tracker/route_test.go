@@ -0,0 +1,49 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import "testing"
+
+func TestReversePathMapSwitches(t *testing.T) {
+	param := MapTrackerMoveParam{
+		MapName: "map01_lv001",
+		Path: []Waypoint{
+			{X: 10, Y: 10},
+			{X: 20, Y: 20},
+			{X: 30, Y: 30, MapName: "map01_lv002"},
+			{X: 40, Y: 40},
+			{X: 50, Y: 50},
+		},
+	}
+	want := make(map[[2]int]string, len(param.Path))
+	for i, w := range param.Path {
+		want[w.Point()] = param.waypointMap(i)
+	}
+
+	param.reversePath()
+
+	if param.MapName != "map01_lv002" {
+		t.Errorf("map_name is %s, want map01_lv002", param.MapName)
+	}
+	if got := param.Path[0].Point(); got != [2]int{50, 50} {
+		t.Fatalf("first point is %v, want [50 50]", got)
+	}
+	for i, w := range param.Path {
+		if got := param.waypointMap(i); got != want[w.Point()] {
+			t.Errorf("point %d %v is on %s, want %s", i, w.Point(), got, want[w.Point()])
+		}
+	}
+	if param.Path[3].MapName != "map01_lv001" {
+		t.Errorf("map switch is not on the first point of map01_lv001, path: %+v", param.Path)
+	}
+
+	// Reversing twice restores the original map assignment
+	param.reversePath()
+	for i, w := range param.Path {
+		if got := param.waypointMap(i); got != want[w.Point()] {
+			t.Errorf("point %d %v is on %s after reversing twice, want %s", i, w.Point(), got, want[w.Point()])
+		}
+	}
+	if param.MapName != "map01_lv001" || param.Path[2].MapName != "map01_lv002" {
+		t.Errorf("reversing twice did not restore the map switch, path: %+v", param.Path)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/MaaXYZ/maa-framework-go/v4"
+	"github.com/rs/zerolog/log"
+)
+
+type MapTrackerRunRoute struct{}
+
+// MapTrackerRunRouteParam represents the custom_action_param for MapTrackerRunRoute.
+// It accepts all optional movement parameters of MapTrackerMoveParam as defaults for the routes,
+// except for MapName and Path.
+type MapTrackerRunRouteParam struct {
+	MapTrackerMoveParam
+	// Routes is the chain of routes to run in order (required).
+	Routes []RouteRef `json:"routes"`
+	// Reverse runs the chain backwards, walking each route backwards as well.
+	Reverse bool `json:"reverse,omitempty"`
+	// Loop is the number of times to run the chain.
+	Loop int `json:"loop,omitempty"`
+}
+
+var _ maa.CustomActionRunner = &MapTrackerRunRoute{}
+
+// Run implements maa.CustomActionRunner
+func (a *MapTrackerRunRoute) Run(ctx *maa.Context, arg *maa.CustomActionArg) bool {
+	param, err := a.parseParam(arg.CustomActionParam)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse parameters for MapTrackerRunRoute")
+		return false
+	}
+
+	// Load all routes before moving, so that a broken route fails early
+	chain := make([]*MapTrackerMoveParam, 0, len(param.Routes))
+	for _, ref := range param.Routes {
+		route, err := loadRoute(ref, &param.MapTrackerMoveParam)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load route")
+			return false
+		}
+		chain = append(chain, route)
+	}
+
+	for loop := 0; loop < param.Loop; loop++ {
+		for idx, route := range chain {
+			log.Info().
+				Str("route", param.Routes[idx].Name).
+				Bool("reverse", param.Routes[idx].Reverse).
+				Int("loop", loop).
+				Msg("Running route")
+			if doMove(ctx, route) != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (a *MapTrackerRunRoute) parseParam(paramStr string) (*MapTrackerRunRouteParam, error) {
+	var param MapTrackerRunRouteParam
+	if err := json.Unmarshal([]byte(paramStr), &param); err != nil {
+		return nil, fmt.Errorf("failed to parse parameters: %w", err)
+	}
+	if len(param.Routes) == 0 {
+		return nil, fmt.Errorf("routes is required in parameters, got empty")
+	}
+	if param.MapName != "" || len(param.Path) != 0 {
+		return nil, fmt.Errorf("map_name and path must not be set, they are loaded from the routes")
+	}
+	if param.Loop < 0 {
+		return nil, fmt.Errorf("loop must be non-negative")
+	} else if param.Loop == 0 {
+		param.Loop = 1
+	}
+
+	if param.Reverse {
+		slices.Reverse(param.Routes)
+		for idx := range param.Routes {
+			param.Routes[idx].Reverse = !param.Routes[idx].Reverse
+		}
+	}
+	return &param, nil
+}
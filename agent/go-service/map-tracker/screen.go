@@ -0,0 +1,36 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"image"
+)
+
+// detectScreenTransition tells whether the screen is in a transition, such as a black loading screen
+// or a white teleport flash, by the luminance of a sparse grid of pixels.
+// Other transition screens are left to the inference, which fails without a visible mini-map.
+// Returns the kind of the transition screen, or an empty string for a normal screen.
+func detectScreenTransition(img image.Image) string {
+	rgba := ToRGBA(img)
+	b := rgba.Rect
+	dark, bright, count := 0, 0, 0
+	for y := b.Min.Y + SCREEN_SAMPLE_STEP/2; y < b.Max.Y; y += SCREEN_SAMPLE_STEP {
+		for x := b.Min.X + SCREEN_SAMPLE_STEP/2; x < b.Max.X; x += SCREEN_SAMPLE_STEP {
+			o := rgba.PixOffset(x, y)
+			luma := 0.299*float64(rgba.Pix[o]) + 0.587*float64(rgba.Pix[o+1]) + 0.114*float64(rgba.Pix[o+2])
+			if luma <= SCREEN_DARK_LUMA {
+				dark++
+			} else if luma >= SCREEN_BRIGHT_LUMA {
+				bright++
+			}
+			count++
+		}
+	}
+
+	if count > 0 && float64(dark) >= float64(count)*SCREEN_FILL_RATIO {
+		return SCREEN_BLACK
+	}
+	if count > 0 && float64(bright) >= float64(count)*SCREEN_FILL_RATIO {
+		return SCREEN_WHITE
+	}
+	return ""
+}
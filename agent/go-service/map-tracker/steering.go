@@ -0,0 +1,151 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/MaaXYZ/maa-framework-go/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// pursuitController steers the player towards a lookahead point with a PID controller on heading,
+// estimating the camera sensitivity (pixels per degree) online from observed rotations
+type pursuitController struct {
+	tasker maa.Tasker
+	param  *MapTrackerMoveParam
+	// sensitivity is the current camera sensitivity estimate in pixels per degree
+	sensitivity float64
+
+	integral float64
+	prevErr  float64
+	prevTime time.Time
+	// pending is the last camera rotation waiting to be observed
+	pending *rotationSample
+}
+
+// rotationSample is a camera rotation command and the player rotation before it
+type rotationSample struct {
+	rot    int
+	pixels int
+}
+
+var (
+	sensitivityMu sync.Mutex
+	sensitivities = make(map[maa.Tasker]float64)
+)
+
+func newPursuitController(tasker maa.Tasker, param *MapTrackerMoveParam) *pursuitController {
+	sensitivity := param.RotationSpeed
+	sensitivityMu.Lock()
+	if s, ok := sensitivities[tasker]; ok {
+		sensitivity = s
+	}
+	sensitivityMu.Unlock()
+	return &pursuitController{tasker: tasker, param: param, sensitivity: sensitivity}
+}
+
+// reset clears the controller state, e.g. after the player moved without steering
+func (c *pursuitController) reset() {
+	c.integral = 0
+	c.prevErr = 0
+	c.prevTime = time.Time{}
+	c.pending = nil
+}
+
+// steer adjusts the camera for the given heading error and keeps the player walking
+func (c *pursuitController) steer(aw *ActionWrapper, rot, deltaRot int, now time.Time) {
+	c.observe(rot)
+
+	e := float64(deltaRot)
+	if math.Abs(e) > c.param.RotationUpperThreshold {
+		// Stop and rotate for large misalignment, same as the step mode
+		aw.KeyUpSync(KEY_W, 0)
+		c.rotate(aw, rot, e)
+		aw.KeyDownSync(KEY_W, 100)
+		c.integral, c.prevTime = 0, time.Time{}
+		return
+	}
+
+	deriv := 0.0
+	dt := float64(INFER_INTERVAL_MS) / 1000.0
+	if !c.prevTime.IsZero() {
+		dt = max(now.Sub(c.prevTime).Seconds(), 1e-3)
+		deriv = (e - c.prevErr) / dt
+	}
+	c.integral = max(-PURSUIT_INTEGRAL_LIMIT, min(PURSUIT_INTEGRAL_LIMIT, c.integral+e*dt))
+	c.prevErr, c.prevTime = e, now
+
+	u := PURSUIT_KP*e + PURSUIT_KI*c.integral + PURSUIT_KD*deriv
+	log.Debug().Float64("err", e).Float64("u", u).Float64("sensitivity", c.sensitivity).Msg("Pursuit steering")
+	if math.Abs(u) >= PURSUIT_DEADBAND {
+		c.rotate(aw, rot, u)
+	}
+	aw.KeyDownSync(KEY_W, 100)
+}
+
+// rotate rotates the camera by the given degrees using the current sensitivity
+func (c *pursuitController) rotate(aw *ActionWrapper, rot int, degrees float64) {
+	pixels := int(math.Round(degrees * c.sensitivity))
+	if pixels == 0 {
+		return
+	}
+	aw.RotateCamera(pixels, 100, 100)
+	c.pending = &rotationSample{rot, pixels}
+}
+
+// observe updates the sensitivity estimate from the rotation caused by the pending camera rotation
+func (c *pursuitController) observe(rot int) {
+	if c.pending == nil {
+		return
+	}
+	observed := calcDeltaRotation(c.pending.rot, rot)
+	pixels := c.pending.pixels
+	c.pending = nil
+	// Ignore small or contradicting observations, which are dominated by inference noise
+	if absInt(observed) < SENSITIVITY_MIN_DELTA || (observed > 0) != (pixels > 0) {
+		return
+	}
+
+	sample := float64(pixels) / float64(observed)
+	seed := c.param.RotationSpeed
+	estimate := (1-SENSITIVITY_EMA_ALPHA)*c.sensitivity + SENSITIVITY_EMA_ALPHA*sample
+	c.sensitivity = max(seed/SENSITIVITY_RANGE, min(seed*SENSITIVITY_RANGE, estimate))
+
+	sensitivityMu.Lock()
+	sensitivities[c.tasker] = c.sensitivity
+	sensitivityMu.Unlock()
+	log.Debug().Float64("sample", sample).Float64("sensitivity", c.sensitivity).Msg("Camera sensitivity updated")
+}
+
+// calcLookaheadPoint returns the point at the lookahead distance ahead along the path,
+// measured from the projection of (curX, curY) onto the segment from (fromX, fromY) to path[index].
+// Looking ahead stops at the last point, at points that must be reached exactly
+// and at points followed by a map switch.
+func calcLookaheadPoint(path []Waypoint, index int, fromX, fromY, curX, curY int, lookahead float64) (int, int) {
+	ax, ay := float64(fromX), float64(fromY)
+	bx, by := float64(path[index].X), float64(path[index].Y)
+	px, py := bx, by
+	if l2 := (bx-ax)*(bx-ax) + (by-ay)*(by-ay); l2 > 0 {
+		t := ((float64(curX)-ax)*(bx-ax) + (float64(curY)-ay)*(by-ay)) / l2
+		t = max(0, min(1, t))
+		px, py = ax+t*(bx-ax), ay+t*(by-ay)
+	}
+
+	remain := lookahead
+	for k := index; k < len(path); k++ {
+		bx, by = float64(path[k].X), float64(path[k].Y)
+		seg := math.Hypot(bx-px, by-py)
+		if seg >= remain {
+			r := remain / seg
+			return int(math.Round(px + (bx-px)*r)), int(math.Round(py + (by-py)*r))
+		}
+		remain -= seg
+		px, py = bx, by
+		if !path[k].isPassable() || (k+1 < len(path) && path[k+1].MapName != "") {
+			break
+		}
+	}
+	return int(math.Round(px)), int(math.Round(py))
+}
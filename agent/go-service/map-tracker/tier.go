@@ -0,0 +1,144 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// tierNameRegex matches tier map names like "map01_lv001_tier_114",
+// capturing the base map name and the tier ID
+var tierNameRegex = regexp.MustCompile(`^(.+)_tier_(\w+)$`)
+
+// parseTierName splits a map name into its base map name and tier ID.
+// The tier ID is empty if the map is not a tier map.
+func parseTierName(name string) (string, string) {
+	if m := tierNameRegex.FindStringSubmatch(name); m != nil {
+		return m[1], m[2]
+	}
+	return name, ""
+}
+
+// calcTierRegex returns a regex matching the given base map and all of its tiers
+func calcTierRegex(baseName string) string {
+	return "^" + regexp.QuoteMeta(baseName) + "(_tier_\\w+)?$"
+}
+
+// calcMapNamesRegex returns a regex matching the given maps, including the tiers of base maps
+func calcMapNamesRegex(names []string) string {
+	seen := make(map[string]struct{})
+	parts := make([]string, 0, len(names)*2)
+	for _, name := range names {
+		if _, exists := seen[name]; exists {
+			continue
+		}
+		seen[name] = struct{}{}
+		parts = append(parts, regexp.QuoteMeta(name))
+		if !isTierName(name) {
+			// Include the tier layers of base maps
+			parts = append(parts, regexp.QuoteMeta(name)+"_tier_\\w+")
+		}
+	}
+	return "^(" + strings.Join(parts, "|") + ")$"
+}
+
+// resolveTiers links each tier map to its base map and computes the offset
+// from tier coordinates to base map coordinates.
+// heights holds the original (uncropped) image height of each map.
+//
+// Tier images are merged from the same tile grid as their base map, where x counts
+// from the left and y counts from the bottom (see map_tracker_merger.py), so they
+// share the x origin and are shifted vertically by the difference in tile rows.
+func resolveTiers(maps []MapCache, heights map[string]int) {
+	for idx := range maps {
+		m := &maps[idx]
+		base, tier := parseTierName(m.Name)
+		m.BaseName, m.Tier = base, tier
+		if tier == "" {
+			continue
+		}
+
+		baseH, ok := heights[base]
+		if !ok {
+			log.Warn().Str("map", m.Name).Str("base", base).Msg("Base map of tier not found, treating tier as a standalone map")
+			m.BaseName, m.Tier = m.Name, ""
+			continue
+		}
+		m.BaseOffsetX = 0
+		m.BaseOffsetY = calcTierOffsetY(baseH, heights[m.Name])
+	}
+}
+
+// calcTierOffsetY returns the vertical offset from tier coordinates to base map coordinates,
+// given the original image heights of the base map and the tier map
+func calcTierOffsetY(baseH, tierH int) int {
+	baseRows := math.Round(float64(baseH) / MAP_TILE_SIZE)
+	tierRows := math.Round(float64(tierH) / MAP_TILE_SIZE)
+	return int(math.Round((baseRows - tierRows) * MAP_TILE_SIZE))
+}
+
+// loadTierOffset returns the offset from the coordinates of the given map to its base map coordinates,
+// reading only the image headers of the map resources. The offset of a base map is zero.
+func loadTierOffset(mapName string) (int, int, error) {
+	baseName, tier := parseTierName(mapName)
+	if tier == "" {
+		return 0, 0, nil
+	}
+	heights := make(map[string]int, 2)
+	for _, name := range []string{baseName, mapName} {
+		path := findResource(filepath.Join(MAP_DIR, name+".png"))
+		if path == "" {
+			return 0, 0, fmt.Errorf("map image %s not found", name)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to open map image: %w", err)
+		}
+		cfg, _, err := image.DecodeConfig(file)
+		file.Close()
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to decode map image %s: %w", name, err)
+		}
+		heights[name] = cfg.Height
+	}
+	return 0, calcTierOffsetY(heights[baseName], heights[mapName]), nil
+}
+
+// findMap returns the loaded map with the given name, or nil if not found
+func (i *MapTrackerInfer) findMap(name string) *MapCache {
+	for idx := range i.maps {
+		if i.maps[idx].Name == name {
+			return &i.maps[idx]
+		}
+	}
+	return nil
+}
+
+// isTierName returns whether the map name refers to a tier map
+func isTierName(name string) bool {
+	_, tier := parseTierName(name)
+	return tier != ""
+}
+
+// isSameBaseMap returns whether the two maps, or their base maps if they are tier maps, are the same
+func isSameBaseMap(a, b string) bool {
+	baseA, _ := parseTierName(a)
+	baseB, _ := parseTierName(b)
+	return baseA == baseB
+}
+
+// calcFramePosition returns the inferred position in the coordinate frame of the given map,
+// which is the base map frame unless the result is exactly on that map
+func calcFramePosition(result *MapTrackerInferResult, mapName string) (int, int) {
+	if result.MapName == mapName {
+		return result.X, result.Y
+	}
+	return result.BaseX, result.BaseY
+}
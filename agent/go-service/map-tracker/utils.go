@@ -5,6 +5,8 @@ import (
 	"image"
 	"image/draw"
 	"math"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/MaaXYZ/maa-framework-go/v4"
@@ -24,6 +26,11 @@ type IntegralImage struct {
 type NeedleStats struct {
 	Mn float64 // Mean pixel value of the needle
 	Dn float64 // Standard deviation of the needle
+	// Count is the number of used pixels of the needle, i.e. those in Runs if masked.
+	Count int
+	// Runs are the used pixels of a masked needle, or nil if the whole needle is used.
+	// Pixels outside the runs must be zero.
+	Runs []maskRun
 }
 
 // NewIntegralImage computes the integral images for an RGBA image
@@ -57,6 +64,17 @@ func NewIntegralImage(img *image.RGBA) *IntegralImage {
 	return &IntegralImage{Sum: sum, SumSq: sumSq, W: w, H: h}
 }
 
+// GetMaskedStats returns (sum, sumSq) over the mask runs placed at (x, y), in O(len(runs))
+func (ii *IntegralImage) GetMaskedStats(x, y int, runs []maskRun) (float64, float64) {
+	var s, sq float64
+	for _, r := range runs {
+		rs, rsq := ii.GetAreaStats(x+r.X0, y+r.Y, r.X1-r.X0, 1)
+		s += rs
+		sq += rsq
+	}
+	return s, sq
+}
+
 // GetAreaStats returns (sum, sumSq) for a given rectangle in O(1)
 func (ii *IntegralImage) GetAreaStats(x, y, w, h int) (float64, float64) {
 	stride := ii.W + 1
@@ -95,28 +113,6 @@ func scaleImage(img image.Image, scale float64) image.Image {
 	return dst
 }
 
-func rotateImageRGBA(imgRGBA *image.RGBA, angle float64) *image.RGBA {
-	bounds := imgRGBA.Bounds()
-	w, h := bounds.Dx(), bounds.Dy()
-	cx, cy := float64(w)/2, float64(h)/2
-	rad := angle * math.Pi / 180.0
-	cos, sin := math.Cos(rad), math.Sin(rad)
-	dst := image.NewRGBA(bounds)
-	ds, ss := dst.Stride, imgRGBA.Stride
-	dp, sp := dst.Pix, imgRGBA.Pix
-
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			fx, fy := float64(x)-cx, float64(y)-cy
-			sx, sy := int(fx*cos+fy*sin+cx), int(-fx*sin+fy*cos+cy)
-			if sx >= 0 && sx < w && sy >= 0 && sy < h {
-				copy(dp[y*ds+x*4:y*ds+x*4+4], sp[sy*ss+sx*4:sy*ss+sx*4+4])
-			}
-		}
-	}
-	return dst
-}
-
 func ToRGBA(img image.Image) *image.RGBA {
 	if dst, ok := img.(*image.RGBA); ok {
 		return dst
@@ -142,14 +138,107 @@ func GetNeedleStats(nRGBA *image.RGBA) *NeedleStats {
 	}
 	cnt := float64(nW * nH * 3)
 	mn, dn := sn/cnt, math.Sqrt(ssn-cnt*(sn/cnt)*(sn/cnt))
-	return &NeedleStats{Mn: mn, Dn: dn}
+	return &NeedleStats{Mn: mn, Dn: dn, Count: nW * nH}
 }
 
-func MatchTemplateOptimized(
+// GetMaskedNeedleStats is like GetNeedleStats, but only counts the pixels of the mask,
+// zeroing the other pixels of the needle in place
+func GetMaskedNeedleStats(nRGBA *image.RGBA, mask *image.Gray) *NeedleStats {
+	nW, nH := nRGBA.Rect.Dx(), nRGBA.Rect.Dy()
+	runs := calcMaskRuns(scaleMask(mask, nW, nH))
+	var sn, ssn float64
+	np, ns := nRGBA.Pix, nRGBA.Stride
+	used := make([]bool, nW*nH)
+	count := 0
+	for _, run := range runs {
+		for x := run.X0; x < run.X1; x++ {
+			used[run.Y*nW+x] = true
+			o := run.Y*ns + x*4
+			r, g, b := float64(np[o]), float64(np[o+1]), float64(np[o+2])
+			sn += r + g + b
+			ssn += r*r + g*g + b*b
+		}
+		count += run.X1 - run.X0
+	}
+	for y := 0; y < nH; y++ {
+		for x := 0; x < nW; x++ {
+			if !used[y*nW+x] {
+				o := y*ns + x*4
+				np[o], np[o+1], np[o+2] = 0, 0, 0
+			}
+		}
+	}
+	if count == 0 {
+		return &NeedleStats{Runs: runs}
+	}
+	cnt := float64(count * 3)
+	mn, dn := sn/cnt, math.Sqrt(max(ssn-cnt*(sn/cnt)*(sn/cnt), 0))
+	return &NeedleStats{Mn: mn, Dn: dn, Count: count, Runs: runs}
+}
+
+// MatchOptions controls the search strategy of template matching
+type MatchOptions struct {
+	// Step is the stride of the coarse grid of positions, which is refined around the best ones.
+	// A step of 1 searches exhaustively.
+	Step int
+	// Certain stops the search early once a coarse score reaches it, if positive.
+	Certain float64
+	// Backend is the way to compute the scores, one of "auto", "direct" and "fft".
+	// The "fft" backend scores every position exhaustively, ignoring Step and Certain.
+	Backend string
+}
+
+// NewMatchOptions picks the coarse grid step for a needle of the given size and the precision,
+// where larger needles and lower precisions take larger steps,
+// and stops early on scores of MATCH_CERTAIN_SCORE
+func NewMatchOptions(nW, nH int, precision float64, backend string) MatchOptions {
+	step := int(math.Round(float64(min(nW, nH)) / MATCH_STEP_DIVISOR * (1 - precision/2)))
+	return MatchOptions{Step: max(1, min(MATCH_MAX_STEP, step)), Certain: MATCH_CERTAIN_SCORE, Backend: backend}
+}
+
+// useFFT tells whether to score the posW x posH search positions of a nW x nH needle by FFT.
+// The "auto" backend compares the estimated costs of both backends.
+func (opts MatchOptions) useFFT(posW, posH, nW, nH int) bool {
+	switch opts.Backend {
+	case MATCH_BACKEND_FFT:
+		return true
+	case MATCH_BACKEND_AUTO:
+		// The coarse grid and the fine-tuning pass around the best position
+		step := opts.regionStep(posW, posH)
+		positions := ((posW-1)/step+1)*((posH-1)/step+1) + (2*step-1)*(2*step-1)
+		directCost := float64(positions) * float64(nW*nH*3)
+		return estimateFFTCost(posW, posH, nW, nH) < directCost
+	}
+	return false
+}
+
+// regionStep returns the step to use for a search region of the given size,
+// keeping at least MATCH_MIN_GRID coarse positions along each axis
+func (opts MatchOptions) regionStep(w, h int) int {
+	return max(1, min(opts.Step, min(w, h)/MATCH_MIN_GRID))
+}
+
+// forEachRow calls fn for every row in [0, rows), on the shared pool if there are enough positions
+func forEachRow(rows, cols int, fn func(r int)) {
+	if rows*cols < MATCH_PARALLEL_MIN_POSITIONS {
+		for r := 0; r < rows; r++ {
+			fn(r)
+		}
+		return
+	}
+	parallelFor(rows, fn)
+}
+
+// MatchTemplateInRegion finds the best NCC match of the needle in the haystack, searching the
+// top-left positions (x, y) inside the given region on a coarse grid and fine-tuning around the best one.
+// Returns (x, y, score) of the best match, or (0, 0, 0.0) if the region is empty.
+func MatchTemplateInRegion(
 	hRGBA *image.RGBA,
 	hInt *IntegralImage,
 	nRGBA *image.RGBA,
 	nStats *NeedleStats,
+	region image.Rectangle,
+	opts MatchOptions,
 ) (int, int, float64) {
 	hW, hH, nW, nH := hRGBA.Rect.Dx(), hRGBA.Rect.Dy(), nRGBA.Rect.Dx(), nRGBA.Rect.Dy()
 	if nW > hW || nH > hH {
@@ -157,45 +246,59 @@ func MatchTemplateOptimized(
 	}
 
 	// Calculate search bounds for the top-left corner (x, y)
-	minX, minY := 0, 0
-	maxX, maxY := hW-nW, hH-nH
-
-	type result struct {
-		x, y int
-		s    float64
+	minX, minY := max(0, region.Min.X), max(0, region.Min.Y)
+	maxX, maxY := min(hW-nW, region.Max.X-1), min(hH-nH, region.Max.Y-1)
+	if minX > maxX || minY > maxY {
+		return 0, 0, 0.0
 	}
-	numWorkers, step := 6, 3
-	resChan := make(chan result, numWorkers)
-	rows := maxY - minY + 1
-
-	for i := 0; i < numWorkers; i++ {
-		go func(id int) {
-			lx, ly, lm := 0, 0, -1.0
-			for y := minY + id*step; y < minY+rows; y += numWorkers * step {
-				for x := minX; x <= maxX; x += step {
-					s := computeNCCFast(hRGBA, hInt, nRGBA, x, y, nStats.Mn, nStats.Dn)
-					if s > lm {
-						lm, lx, ly = s, x, y
-					}
-				}
+
+	if opts.useFFT(maxX-minX+1, maxY-minY+1, nW, nH) {
+		cols := maxX - minX + 1
+		best := MatchPeak{minX, minY, -1.0}
+		for idx, s := range matchScoresFFT(hRGBA, hInt, nRGBA, nStats, minX, minY, maxX, maxY) {
+			if s > best.Score {
+				best = MatchPeak{minX + idx%cols, minY + idx/cols, s}
 			}
-			resChan <- result{lx, ly, lm}
-		}(i)
+		}
+		return best.X, best.Y, best.Score
 	}
 
-	bc := result{minX, minY, -1.0}
-	for i := 0; i < numWorkers; i++ {
-		r := <-resChan
-		if r.s > bc.s {
+	// Score the coarse grid, keeping the best of each row
+	step := opts.regionStep(maxX-minX+1, maxY-minY+1)
+	cols, rows := (maxX-minX)/step+1, (maxY-minY)/step+1
+	rowBest := make([]MatchPeak, rows)
+	var certain atomic.Bool
+	forEachRow(rows, cols, func(r int) {
+		y := minY + r*step
+		best := MatchPeak{minX, y, -1.0}
+		if certain.Load() {
+			rowBest[r] = best
+			return
+		}
+		for c := 0; c < cols; c++ {
+			x := minX + c*step
+			if s := computeNCCFast(hRGBA, hInt, nRGBA, x, y, nStats); s > best.Score {
+				best = MatchPeak{x, y, s}
+			}
+		}
+		if opts.Certain > 0 && best.Score >= opts.Certain {
+			certain.Store(true)
+		}
+		rowBest[r] = best
+	})
+
+	bc := MatchPeak{minX, minY, -1.0}
+	for _, r := range rowBest {
+		if r.Score > bc.Score {
 			bc = r
 		}
 	}
 
-	fm, fx, fy := bc.s, bc.x, bc.y
+	fm, fx, fy := bc.Score, bc.X, bc.Y
 	// Fine-tuning pass around the best result
-	for y := max(minY, bc.y-step+1); y < min(maxY+1, bc.y+step); y++ {
-		for x := max(minX, bc.x-step+1); x < min(maxX+1, bc.x+step); x++ {
-			s := computeNCCFast(hRGBA, hInt, nRGBA, x, y, nStats.Mn, nStats.Dn)
+	for y := max(minY, bc.Y-step+1); y < min(maxY+1, bc.Y+step); y++ {
+		for x := max(minX, bc.X-step+1); x < min(maxX+1, bc.X+step); x++ {
+			s := computeNCCFast(hRGBA, hInt, nRGBA, x, y, nStats)
 			if s > fm {
 				fm, fx, fy = s, x, y
 			}
@@ -204,10 +307,116 @@ func MatchTemplateOptimized(
 	return fx, fy, fm
 }
 
-func computeNCCFast(hRGBA *image.RGBA, hInt *IntegralImage, nRGBA *image.RGBA, ox, oy int, mn, dn float64) float64 {
+// MatchPeak is a match position of the needle in the haystack
+type MatchPeak struct {
+	X, Y  int
+	Score float64
+}
+
+// MatchTemplateTopK is like MatchTemplateInRegion, but returns up to k best matches
+// that are more than minDist apart from each other (non-maximum suppression).
+// It always scores the whole coarse grid, ignoring opts.Certain.
+// Returns the matches sorted by score in descending order.
+func MatchTemplateTopK(
+	hRGBA *image.RGBA,
+	hInt *IntegralImage,
+	nRGBA *image.RGBA,
+	nStats *NeedleStats,
+	region image.Rectangle,
+	k int,
+	minDist int,
+	opts MatchOptions,
+) []MatchPeak {
+	hW, hH, nW, nH := hRGBA.Rect.Dx(), hRGBA.Rect.Dy(), nRGBA.Rect.Dx(), nRGBA.Rect.Dy()
+	if nW > hW || nH > hH || k <= 0 {
+		return nil
+	}
+
+	// Calculate search bounds for the top-left corner (x, y)
+	minX, minY := max(0, region.Min.X), max(0, region.Min.Y)
+	maxX, maxY := min(hW-nW, region.Max.X-1), min(hH-nH, region.Max.Y-1)
+	if minX > maxX || minY > maxY {
+		return nil
+	}
+
+	// Score the coarse grid, or every position by FFT keeping only the local maxima
+	var scores []MatchPeak
+	step := opts.regionStep(maxX-minX+1, maxY-minY+1)
+	if opts.useFFT(maxX-minX+1, maxY-minY+1, nW, nH) {
+		step = 1
+		scores = localMaxima(matchScoresFFT(hRGBA, hInt, nRGBA, nStats, minX, minY, maxX, maxY), minX, minY, maxX-minX+1)
+	} else {
+		cols, rows := (maxX-minX)/step+1, (maxY-minY)/step+1
+		scores = make([]MatchPeak, cols*rows)
+		forEachRow(rows, cols, func(r int) {
+			y := minY + r*step
+			for c := 0; c < cols; c++ {
+				x := minX + c*step
+				scores[r*cols+c] = MatchPeak{x, y, computeNCCFast(hRGBA, hInt, nRGBA, x, y, nStats)}
+			}
+		})
+	}
+
+	// Greedy non-maximum suppression
+	slices.SortFunc(scores, func(a, b MatchPeak) int {
+		if a.Score > b.Score {
+			return -1
+		} else if a.Score < b.Score {
+			return 1
+		}
+		return 0
+	})
+	peaks := make([]MatchPeak, 0, k)
+	for _, s := range scores {
+		suppressed := false
+		for _, p := range peaks {
+			if absInt(s.X-p.X) <= minDist && absInt(s.Y-p.Y) <= minDist {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			peaks = append(peaks, s)
+			if len(peaks) == k {
+				break
+			}
+		}
+	}
+
+	// Fine-tuning pass around each peak
+	for idx := range peaks {
+		p := &peaks[idx]
+		bx, by := p.X, p.Y
+		for y := max(minY, by-step+1); y < min(maxY+1, by+step); y++ {
+			for x := max(minX, bx-step+1); x < min(maxX+1, bx+step); x++ {
+				s := computeNCCFast(hRGBA, hInt, nRGBA, x, y, nStats)
+				if s > p.Score {
+					p.X, p.Y, p.Score = x, y, s
+				}
+			}
+		}
+	}
+	return peaks
+}
+
+func computeNCCFast(hRGBA *image.RGBA, hInt *IntegralImage, nRGBA *image.RGBA, ox, oy int, nStats *NeedleStats) float64 {
 	nW, nH := nRGBA.Rect.Dx(), nRGBA.Rect.Dy()
 	hp, np, hs, ns := hRGBA.Pix, nRGBA.Pix, hRGBA.Stride, nRGBA.Stride
 	var dot uint64
+	if nStats.Runs != nil {
+		// Only the pixels of the mask are non-zero
+		for _, r := range nStats.Runs {
+			hi, ni := (oy+r.Y)*hs+(ox+r.X0)*4, r.Y*ns+r.X0*4
+			for x := r.X0; x < r.X1; x++ {
+				dot += uint64(hp[hi]) * uint64(np[ni])
+				dot += uint64(hp[hi+1]) * uint64(np[ni+1])
+				dot += uint64(hp[hi+2]) * uint64(np[ni+2])
+				hi += 4
+				ni += 4
+			}
+		}
+		return nccFromDot(hInt, ox, oy, nW, nH, float64(dot), nStats)
+	}
 	rb := oy*hs + ox*4
 	for y := 0; y < nH; y++ {
 		hi, ni := rb, y*ns
@@ -220,15 +429,60 @@ func computeNCCFast(hRGBA *image.RGBA, hInt *IntegralImage, nRGBA *image.RGBA, o
 		}
 		rb += hs
 	}
-	shn := float64(dot)
-	sh, ssh := hInt.GetAreaStats(ox, oy, nW, nH)
-	cnt := float64(nW * nH * 3)
+	return nccFromDot(hInt, ox, oy, nW, nH, float64(dot), nStats)
+}
+
+// nccFromDot computes the NCC score at (ox, oy) from the dot product of the needle and the haystack there,
+// using the masked statistics of the haystack if the needle is masked
+func nccFromDot(hInt *IntegralImage, ox, oy, nW, nH int, shn float64, nStats *NeedleStats) float64 {
+	cnt := float64(nStats.Count * 3)
+	if cnt == 0 {
+		return 0.0
+	}
+	var sh, ssh float64
+	if nStats.Runs != nil {
+		sh, ssh = hInt.GetMaskedStats(ox, oy, nStats.Runs)
+	} else {
+		sh, ssh = hInt.GetAreaStats(ox, oy, nW, nH)
+	}
 	mh := sh / cnt
-	dh := math.Sqrt(ssh - cnt*mh*mh)
+	dh := math.Sqrt(max(ssh-cnt*mh*mh, 0))
 	if dh < 1e-6 {
 		return 0.0
 	}
-	return (shn - cnt*mh*mn) / (dh * dn)
+	return (shn - cnt*mh*nStats.Mn) / (dh * nStats.Dn)
+}
+
+// localMaxima returns the positions of a row-major score grid that are not lower than their 8 neighbors,
+// where the grid starts at (minX, minY) with the given number of columns
+func localMaxima(scores []float64, minX, minY, cols int) []MatchPeak {
+	rows := len(scores) / cols
+	peaks := make([]MatchPeak, 0)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			s := scores[r*cols+c]
+			isMax := true
+			for dr := max(0, r-1); dr <= min(rows-1, r+1) && isMax; dr++ {
+				for dc := max(0, c-1); dc <= min(cols-1, c+1); dc++ {
+					if scores[dr*cols+dc] > s {
+						isMax = false
+						break
+					}
+				}
+			}
+			if isMax {
+				peaks = append(peaks, MatchPeak{minX + c, minY + r, s})
+			}
+		}
+	}
+	return peaks
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
 }
 
 /* ******** Actions ******** */
@@ -0,0 +1,91 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Waypoint is a target point of a MapTrackerMove path.
+// In JSON, it is either a bare [x, y] array or an object with a "point" field and optional settings.
+type Waypoint struct {
+	// X and Y are the coordinates of the target point.
+	X int
+	Y int
+	// StuckRecovery overrides the stuck recovery sequence on the way to this point.
+	StuckRecovery []string
+	// Action is the action to perform at this point, e.g. "interact" and "run_node".
+	Action string
+	// Node is the pipeline node to run for the "run_node" action.
+	Node string
+	// Tolerance overrides the arrival threshold of this point if positive.
+	Tolerance float64
+	// MapName switches the map of this point and the following ones, if not empty.
+	// The player is expected to reach the new map on the way to this point, e.g. through a loading screen.
+	MapName string
+}
+
+// waypointObject is the object form of Waypoint in JSON
+type waypointObject struct {
+	Point         [2]int   `json:"point"`
+	StuckRecovery []string `json:"stuck_recovery,omitempty"`
+	Action        string   `json:"action,omitempty"`
+	Node          string   `json:"node,omitempty"`
+	Tolerance     float64  `json:"tolerance,omitempty"`
+	MapName       string   `json:"map_name,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (w *Waypoint) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var point [2]int
+		if err := json.Unmarshal(data, &point); err != nil {
+			return fmt.Errorf("invalid waypoint %s: %w", data, err)
+		}
+		*w = Waypoint{X: point[0], Y: point[1]}
+		return nil
+	}
+
+	var obj waypointObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("invalid waypoint %s: %w", data, err)
+	}
+	*w = Waypoint{
+		X:             obj.Point[0],
+		Y:             obj.Point[1],
+		StuckRecovery: obj.StuckRecovery,
+		Action:        obj.Action,
+		Node:          obj.Node,
+		Tolerance:     obj.Tolerance,
+		MapName:       obj.MapName,
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, using the bare [x, y] form when possible
+func (w Waypoint) MarshalJSON() ([]byte, error) {
+	if len(w.StuckRecovery) == 0 && w.Action == "" && w.Node == "" && w.Tolerance == 0 && w.MapName == "" {
+		return json.Marshal([2]int{w.X, w.Y})
+	}
+	return json.Marshal(waypointObject{
+		Point:         [2]int{w.X, w.Y},
+		StuckRecovery: w.StuckRecovery,
+		Action:        w.Action,
+		Node:          w.Node,
+		Tolerance:     w.Tolerance,
+		MapName:       w.MapName,
+	})
+}
+
+// Point returns the coordinates of the waypoint as [x, y]
+func (w Waypoint) Point() [2]int {
+	return [2]int{w.X, w.Y}
+}
+
+// isPassable tells whether the waypoint may be passed through without exactly reaching it,
+// i.e. it has neither an action nor a custom tolerance
+func (w Waypoint) isPassable() bool {
+	return w.Action == "" && w.Tolerance == 0
+}
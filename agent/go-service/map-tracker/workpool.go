@@ -0,0 +1,110 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// workPool is a fixed set of goroutines shared by all template matching calls,
+// so that concurrent inferences do not oversubscribe the CPU
+type workPool struct {
+	size  int
+	tasks chan func()
+}
+
+var (
+	matchPoolOnce sync.Once
+	matchPool     *workPool
+	// matchWorkers overrides the size of the pool if positive, before it is started
+	matchWorkers int
+)
+
+// getMatchPool returns the shared pool, starting it on first use.
+// Its size is GOMAXPROCS minus MATCH_RESERVED_PROCS (at least 1), leaving some CPU to the game,
+// and the calling goroutine counts as one of the workers.
+func getMatchPool() *workPool {
+	matchPoolOnce.Do(func() {
+		size := matchWorkers
+		if size <= 0 {
+			size = max(1, runtime.GOMAXPROCS(0)-MATCH_RESERVED_PROCS)
+		}
+		matchPool = newWorkPool(size)
+	})
+	return matchPool
+}
+
+// newWorkPool starts a pool of the given size, with size - 1 goroutines
+func newWorkPool(size int) *workPool {
+	p := &workPool{size: size, tasks: make(chan func(), size)}
+	for range size - 1 {
+		go func() {
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+	return p
+}
+
+// setMatchWorkers overrides the size of the shared pool.
+// It has no effect once the pool is started.
+func setMatchWorkers(n int) {
+	matchWorkers = n
+}
+
+// parallelFor calls fn for every k in [0, n) on the shared pool and waits for all of them.
+// The caller works on the items as well, so it makes progress even if the pool is busy.
+// Only the submitted tasks that started before the caller ran out of items are waited for,
+// the others do nothing when they run later, so fn may call parallelFor itself
+// without waiting for tasks queued behind a blocked worker.
+func parallelFor(n int, fn func(k int)) {
+	pool := getMatchPool()
+	var next atomic.Int64
+	work := func() {
+		for {
+			k := int(next.Add(1)) - 1
+			if k >= n {
+				return
+			}
+			fn(k)
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		done    bool
+		running sync.WaitGroup
+	)
+	task := func() {
+		mu.Lock()
+		if done {
+			mu.Unlock()
+			return
+		}
+		running.Add(1)
+		mu.Unlock()
+		defer running.Done()
+		work()
+	}
+	for range min(pool.size, n) - 1 {
+		submitted := true
+		select {
+		case pool.tasks <- task:
+		default:
+			// All workers are busy, leave the rest to the caller
+			submitted = false
+		}
+		if !submitted {
+			break
+		}
+	}
+	work()
+
+	// All items are taken, so tasks that have not started yet have nothing left to do
+	mu.Lock()
+	done = true
+	mu.Unlock()
+	running.Wait()
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2026 Harry Huang
+package maptracker
+
+import (
+	"fmt"
+	"image"
+	"regexp"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// useTestPool replaces the shared pool with a new one of the given size until the test ends
+func useTestPool(tb testing.TB, size int) {
+	tb.Helper()
+	prev := getMatchPool()
+	pool := newWorkPool(size)
+	matchPool = pool
+	tb.Cleanup(func() {
+		matchPool = prev
+		close(pool.tasks)
+	})
+}
+
+func TestParallelForNested(t *testing.T) {
+	useTestPool(t, 2)
+	finished := make(chan struct{})
+	var count atomic.Int64
+	go func() {
+		defer close(finished)
+		parallelFor(4, func(int) {
+			parallelFor(4, func(int) {
+				time.Sleep(time.Millisecond)
+				count.Add(1)
+			})
+		})
+	}()
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("nested parallelFor deadlocked")
+	}
+	if got := count.Load(); got != 16 {
+		t.Errorf("fn called %d times, want 16", got)
+	}
+}
+
+var (
+	benchMapsOnce sync.Once
+	benchMaps     []MapCache
+	benchMapsErr  error
+)
+
+// loadBenchMaps decodes all maps of the map resource directory once,
+// skipping the benchmark if they are not available
+func loadBenchMaps(b *testing.B) []MapCache {
+	b.Helper()
+	benchMapsOnce.Do(func() {
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		benchMaps, benchMapsErr = decodeMaps(testMapDir, &ResourceLoadReport{})
+	})
+	if benchMapsErr != nil || len(benchMaps) == 0 {
+		b.Skipf("maps not available: %v", benchMapsErr)
+	}
+	return benchMaps
+}
+
+// benchWorkerCounts returns the pool sizes to benchmark, from 1 up to GOMAXPROCS
+func benchWorkerCounts() []int {
+	counts := []int{1}
+	for n := 2; n < runtime.GOMAXPROCS(0); n *= 2 {
+		counts = append(counts, n)
+	}
+	if procs := runtime.GOMAXPROCS(0); procs > 1 {
+		counts = append(counts, procs)
+	}
+	return counts
+}
+
+// BenchmarkInferLocation times the global search over all maps with a mini-map cut from one of them
+func BenchmarkInferLocation(b *testing.B) {
+	maps := loadBenchMaps(b)
+	i := &MapTrackerInfer{maps: maps}
+	g := DEFAULT_GEOMETRY
+	mask := buildMinimapMask(&g, nil)
+	var src *image.RGBA
+	for idx := range maps {
+		if maps[idx].Name == "map01_lv005" {
+			src = maps[idx].Img
+		}
+	}
+	if src == nil {
+		b.Skip("map01_lv005 not available")
+	}
+	// Around the essence trigger point, in cropped map coordinates
+	cx, cy := 375, 192
+	miniMap := src.SubImage(image.Rect(cx-40, cy-40, cx+41, cy+41))
+	regex := regexp.MustCompile(".*")
+
+	for _, backend := range []string{MATCH_BACKEND_AUTO, MATCH_BACKEND_DIRECT} {
+		for _, workers := range benchWorkerCounts() {
+			b.Run(fmt.Sprintf("backend=%s/workers=%d", backend, workers), func(b *testing.B) {
+				useTestPool(b, workers)
+				param := DEFAULT_INFERENCE_PARAM
+				param.Backend = backend
+				b.ResetTimer()
+				for range b.N {
+					if c := i.inferLocation(miniMap, mask, &param, regex); len(c) == 0 || c[0].MapName != "map01_lv005" {
+						b.Fatalf("location not found: %+v", c)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkMatchTemplateTopK times the coarse search of a single map with the largest map
+func BenchmarkMatchTemplateTopK(b *testing.B) {
+	maps := loadBenchMaps(b)
+	largest := &maps[0]
+	for idx := range maps {
+		if maps[idx].Img.Rect.Dx()*maps[idx].Img.Rect.Dy() > largest.Img.Rect.Dx()*largest.Img.Rect.Dy() {
+			largest = &maps[idx]
+		}
+	}
+	level := &largest.Levels[0]
+	cx, cy := largest.Img.Rect.Dx()/2, largest.Img.Rect.Dy()/2
+	g := DEFAULT_GEOMETRY
+	needle := newPyramidNeedle(largest.Img.SubImage(image.Rect(cx-40, cy-40, cx+41, cy+41)), buildMinimapMask(&g, nil), level.Scale)
+	region := level.Img.Rect
+	opts := NewMatchOptions(needle.W, needle.H, DEFAULT_INFERENCE_PARAM.Precision, MATCH_BACKEND_DIRECT)
+
+	for _, workers := range benchWorkerCounts() {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			useTestPool(b, workers)
+			b.ResetTimer()
+			for range b.N {
+				MatchTemplateTopK(level.Img, level.Integral, needle.Img, needle.Stats, region, PYRAMID_PEAKS_PER_MAP, needle.W/2, opts)
+			}
+		})
+	}
+}